@@ -5,10 +5,16 @@ import (
 	"fmt"
 	"os"
 	"runtime"
+	"time"
 
 	"github.com/KrakenSystems/wg-operator/pkg/apis"
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/KrakenSystems/wg-operator/pkg/controller/addresspool"
+	"github.com/KrakenSystems/wg-operator/pkg/controller/finalizer"
 	"github.com/KrakenSystems/wg-operator/pkg/controller/node"
+	"github.com/KrakenSystems/wg-operator/pkg/controller/psk"
 	"github.com/KrakenSystems/wg-operator/pkg/logrAdapter"
+	"github.com/KrakenSystems/wg-operator/pkg/webhook"
 	"github.com/operator-framework/operator-sdk/pkg/k8sutil"
 	sdkVersion "github.com/operator-framework/operator-sdk/version"
 	"github.com/sirupsen/logrus"
@@ -39,10 +45,13 @@ func main() {
 	}
 
 	pflag.CommandLine.AddGoFlagSet(flag.CommandLine)
-	mode := pflag.String("mode", "client", "mode the controller is in (server/client)")
+	mode := pflag.String("mode", "client", "mode the controller is in (server/client/auto/controller). Auto configures whichever servers and clients carry the node's name. Controller mode runs the cluster wide controllers instead of configuring the node")
 	nodeName := pflag.String("node-name", hostname, "hostname")
-	iface := pflag.String("wg-interface", "wg0", "interface to configure")
+	iface := pflag.String("wg-interface", "wg0", "interface to configure, unless the node's network sets one")
 	privateKeyFile := pflag.String("wg-private-key-file", "/etc/wireguard/wg0.key", "wireguard private key file")
+	keyRotationInterval := pflag.Duration("key-rotation-interval", 0, "rotate the private key periodically, 0 disables periodic rotation")
+	keyRotationTimeout := pflag.Duration("key-rotation-timeout", 10*time.Minute, "switch over to the new key after this long even if some peers haven't acknowledged it")
+	generateKey := pflag.Bool("generate-private-key", false, "generate the private key file if it's missing and publish its public key into the node's CR")
 	metricsPort := pflag.Int("metrics-port", 6060, "metrics port")
 	metric := pflag.Int("route-metric", 100, "metric to use for routing table")
 	proto := pflag.Int("route-proto", 121, "daemon route table protocol number")
@@ -50,7 +59,26 @@ func main() {
 	dryRun := pflag.BoolP("dry-run", "n", false, "Dry run")
 	syncConfigPath := pflag.String("sync-config-path", "/etc/wireguard", "Config file sync location. PATH/<<iface>>.conf")
 	syncConfig := pflag.Bool("sync-config", false, "whether to sync config files")
+	backendName := pflag.String("backend", backend.KernelName, "how interfaces are configured: kernel uses the kernel module, wireguard-go runs the wireguard-go executable on a TUN device for hosts without it, file only renders the configs into --sync-config-path")
 	splitServers := pflag.Bool("split-servers", false, "create interface per server. Highly experimental")
+	backoffBase := pflag.Duration("sync-backoff-base", 5*time.Second, "initial delay before retrying a failed sync")
+	backoffMax := pflag.Duration("sync-backoff-max", 5*time.Minute, "maximum delay between failed sync retries")
+	finalizerTimeout := pflag.Duration("finalizer-timeout", 0, "controller mode: remove the interface finalizer of deleted servers and clients whose agents didn't within this time, 0 leaves it to the agents")
+	pskRotationInterval := pflag.Duration("psk-rotation-interval", 0, "controller mode: replace generated preshared keys this often, 0 disables rotation")
+	webhookPort := pflag.Int32("webhook-port", 9876, "controller mode: admission webhook port, 0 disables the webhook")
+	webhookCertDir := pflag.String("webhook-cert-dir", "/tmp/cert", "controller mode: directory the webhook's serving certificates are kept in")
+	webhookService := pflag.String("webhook-service", "wg-operator-webhook", "controller mode: service in front of the admission webhook")
+	interfacesFile := pflag.String("interfaces-file", "", "YAML file declaring the interfaces to manage, each with its own CR, mode, key file, route table and metric. By default there's an interface for each CR named after the node or labelled wg.krakensystems.co/node=<node-name>, on its network's interface")
+	stateFile := pflag.String("interface-state-file", "/etc/wireguard/wg-operator.interfaces", "file recording the interfaces the agent created, so they're removed once no longer configured. Empty disables the removal")
+	endpointMaxTTL := pflag.Duration("endpoint-max-ttl", 5*time.Minute, "re-resolve peer endpoint hostnames at least this often, even if their DNS TTL is longer")
+	preferIPv6 := pflag.Bool("prefer-ipv6-endpoints", false, "connect to the IPv6 address of peer endpoint hostnames with both A and AAAA records, IPv4 is preferred by default")
+	statusInterval := pflag.Duration("status-interval", 30*time.Second, "how often to report live peer state into the node's status")
+	healthPort := pflag.Int("health-port", 6061, "port serving /healthz and /readyz, 0 disables them")
+	stuckTimeout := pflag.Duration("stuck-timeout", 5*time.Minute, "report unhealthy once a sync loop hasn't gone around for this long on top of --status-interval")
+	driftCheckInterval := pflag.Duration("drift-check-interval", time.Minute, "compare the interfaces to their applied config this often and correct drift, 0 disables the check")
+	driftReportOnly := pflag.Bool("drift-report-only", false, "only report drift through logs, metrics and events, without correcting it")
+	unreadyTimeout := pflag.Duration("unready-timeout", 2*time.Minute, "report unready once an interface keeps failing to sync for this long")
+	keepInterface := pflag.Bool("keep-interface-on-delete", false, "leave the interfaces up when the node's CR is deleted, by default they're taken down before the CR goes away")
 
 	pflag.Parse()
 
@@ -59,6 +87,34 @@ func main() {
 
 	printVersion()
 
+	// the intervals drive tickers and backoff. Only those documented as disabled by 0 may be 0
+	for _, d := range []struct {
+		flag     string
+		value    time.Duration
+		optional bool
+	}{
+		{"status-interval", *statusInterval, false},
+		{"sync-backoff-base", *backoffBase, false},
+		{"sync-backoff-max", *backoffMax, false},
+		{"stuck-timeout", *stuckTimeout, false},
+		{"unready-timeout", *unreadyTimeout, false},
+		{"endpoint-max-ttl", *endpointMaxTTL, false},
+		{"key-rotation-timeout", *keyRotationTimeout, false},
+		{"key-rotation-interval", *keyRotationInterval, true},
+		{"drift-check-interval", *driftCheckInterval, true},
+		{"psk-rotation-interval", *pskRotationInterval, true},
+		{"finalizer-timeout", *finalizerTimeout, true},
+	} {
+		if d.value < 0 || (d.value == 0 && !d.optional) {
+			log.Error(fmt.Errorf("invalid duration %v", d.value), "--"+d.flag+" must be positive")
+			os.Exit(5)
+		}
+	}
+	if *backoffMax < *backoffBase {
+		log.Error(fmt.Errorf("%v < %v", *backoffMax, *backoffBase), "--sync-backoff-max must not be below --sync-backoff-base")
+		os.Exit(5)
+	}
+
 	namespace, err := k8sutil.GetWatchNamespace()
 	if err != nil {
 		log.Error(err, "Failed to get watch namespace")
@@ -91,17 +147,32 @@ func main() {
 	}
 
 	ctlCfg := node.NodeControllerConfig{
-		NodeName:       *nodeName,
-		Interface:      *iface,
-		PrivateKeyFile: *privateKeyFile,
-		Namespace:      namespace,
-		RouteMetric:    *metric,
-		RouteProto:     *proto,
-		RouteTable:     *table,
-		DryRun:         *dryRun,
-		SyncConfigPath: *syncConfigPath,
-		SyncConfig:     *syncConfig,
-		SplitServers:   *splitServers,
+		NodeName:            *nodeName,
+		Interface:           *iface,
+		PrivateKeyFile:      *privateKeyFile,
+		Namespace:           namespace,
+		RouteMetric:         *metric,
+		RouteProto:          *proto,
+		RouteTable:          *table,
+		DryRun:              *dryRun,
+		SyncConfigPath:      *syncConfigPath,
+		SyncConfig:          *syncConfig,
+		SplitServers:        *splitServers,
+		StatusInterval:      *statusInterval,
+		BackoffBase:         *backoffBase,
+		BackoffMax:          *backoffMax,
+		GeneratePrivateKey:  *generateKey,
+		KeyRotationInterval: *keyRotationInterval,
+		KeyRotationTimeout:  *keyRotationTimeout,
+		StateFile:           *stateFile,
+		EndpointMaxTTL:      *endpointMaxTTL,
+		PreferIPv6Endpoints: *preferIPv6,
+		HealthPort:          *healthPort,
+		StuckTimeout:        *stuckTimeout,
+		UnreadyTimeout:      *unreadyTimeout,
+		DriftCheckInterval:  *driftCheckInterval,
+		DriftReportOnly:     *driftReportOnly,
+		KeepInterfaces:      *keepInterface,
 	}
 
 	switch *mode {
@@ -111,12 +182,53 @@ func main() {
 	case "server":
 		log.Info("Running in server mode", "name", *nodeName)
 		ctlCfg.Mode = node.Server
+	case "auto":
+		log.Info("Running in auto mode", "name", *nodeName)
+		ctlCfg.Mode = node.Auto
+	case "controller":
+		log.Info("Running in controller mode")
 	default:
 		log.Info("unknown mode: " + *mode)
 		os.Exit(5)
 	}
 
-	if err := node.Add(mgr, ctlCfg); err != nil {
+	if ctlCfg.Backend, err = backend.New(*backendName, *syncConfigPath); err != nil {
+		log.Error(err, "Cannot create backend")
+		os.Exit(5)
+	}
+
+	if *interfacesFile != "" && *mode != "controller" {
+		if ctlCfg.Interfaces, err = node.ReadInterfacesFile(*interfacesFile, ctlCfg); err != nil {
+			log.Error(err, "Cannot read interfaces file")
+			os.Exit(5)
+		}
+	}
+
+	if *mode == "controller" {
+		if err := psk.Add(mgr, psk.Config{Namespace: namespace, RotationInterval: *pskRotationInterval}); err != nil {
+			log.Error(err, "Cannot add preshared key controller")
+			os.Exit(6)
+		}
+		if err := addresspool.Add(mgr, addresspool.Config{Namespace: namespace}); err != nil {
+			log.Error(err, "Cannot add address pool controller")
+			os.Exit(6)
+		}
+		if err := finalizer.Add(mgr, finalizer.Config{Namespace: namespace, Timeout: *finalizerTimeout}); err != nil {
+			log.Error(err, "Cannot add finalizer controller")
+			os.Exit(6)
+		}
+		if *webhookPort != 0 {
+			if err := webhook.Add(mgr, webhook.Config{
+				Namespace:   namespace,
+				Port:        *webhookPort,
+				CertDir:     *webhookCertDir,
+				ServiceName: *webhookService,
+			}); err != nil {
+				log.Error(err, "Cannot add admission webhook")
+				os.Exit(6)
+			}
+		}
+	} else if err := node.Add(mgr, ctlCfg); err != nil {
 		log.Error(err, "Cannot add node controller")
 		os.Exit(6)
 	}
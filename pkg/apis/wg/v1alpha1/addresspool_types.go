@@ -0,0 +1,81 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AddressPoolSpec defines the desired state of AddressPool
+// +k8s:openapi-gen=true
+type AddressPoolSpec struct {
+	// CIDRs addresses are allocated from. IPv4 and IPv6 CIDRs can be mixed, nodes get an address from each family
+	CIDRs []string `json:"cidrs"`
+	// Reserved addresses or CIDRs which are never allocated, e.g. statically addressed servers
+	Reserved []string               `json:"reserved,omitempty"`
+	IPv4     *AddressFamilySettings `json:"ipv4,omitempty"`
+	IPv6     *AddressFamilySettings `json:"ipv6,omitempty"`
+}
+
+// AddressFamilySettings tunes allocation for one address family
+// +k8s:openapi-gen=true
+type AddressFamilySettings struct {
+	// Disabled skips allocation from this family's CIDRs
+	Disabled bool `json:"disabled,omitempty"`
+	// PrefixLength written on allocated addresses. Defaults to a host prefix, /32 or /128
+	PrefixLength int `json:"prefixLength,omitempty"`
+}
+
+// AddressPoolStatus defines the observed state of AddressPool
+// +k8s:openapi-gen=true
+type AddressPoolStatus struct {
+	Families    []AddressFamilyStatus `json:"families,omitempty"`
+	Allocations []AddressAllocation   `json:"allocations,omitempty"`
+	// Allocated addresses across all families
+	Allocated int `json:"allocated"`
+	// Utilization of the fullest family in percent
+	Utilization string `json:"utilization,omitempty"`
+}
+
+// AddressFamilyStatus reports pool usage for a single address family
+// +k8s:openapi-gen=true
+type AddressFamilyStatus struct {
+	// Family is either IPv4 or IPv6
+	Family string `json:"family"`
+	// Capacity is the number of allocatable addresses. It's a string since IPv6 pools overflow int64
+	Capacity    string `json:"capacity"`
+	Allocated   int    `json:"allocated"`
+	Utilization string `json:"utilization"`
+}
+
+// AddressAllocation records an address in use by a node
+// +k8s:openapi-gen=true
+type AddressAllocation struct {
+	Address string `json:"address"`
+	// Kind of the node, Server or Client
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AddressPool is the Schema for the addresspools API
+// +k8s:openapi-gen=true
+type AddressPool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AddressPoolSpec   `json:"spec,omitempty"`
+	Status AddressPoolStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AddressPoolList contains a list of AddressPool
+type AddressPoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AddressPool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AddressPool{}, &AddressPoolList{})
+}
@@ -17,30 +17,78 @@ type ClientSpec struct {
 	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
 
 	CommonSpec `json:",inline"`
+	// Endpoint other nodes can reach this client on, host:port. Optional, mesh clients without one are
+	// only reachable once they initiate the handshake
+	Endpoint string `json:"endpoint,omitempty"`
+	// Mesh makes the client peer directly with every other mesh client, not only with servers.
+	// All clients of a network with the Mesh topology are mesh clients
+	Mesh bool `json:"mesh,omitempty"`
+	// ServerSelector limits the servers this client peers with, all servers by default
+	ServerSelector *metav1.LabelSelector `json:"serverSelector,omitempty"`
 }
 
 var _ VPNNode = (*Client)(nil)
 
 func (*Client) isNode() {}
 
-func (client *Client) ToPeerConfig() (wgtypes.PeerConfig, error) {
-	return client.Spec.CommonSpec.toPeerConfig()
+func (client *Client) ToPeerConfigs(resolve Resolver) ([]wgtypes.PeerConfig, error) {
+	peers, err := client.Spec.CommonSpec.toPeerConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if client.Spec.Endpoint == "" {
+		return peers, nil
+	}
+	endpoint, err := resolve(client.Spec.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	for i := range peers {
+		peers[i].Endpoint = endpoint
+	}
+	return peers, nil
 }
 
 func (client *Client) ToInterfaceConfig(privateKeyFile string) (*wgquick.Config, error) {
-	return client.Spec.CommonSpec.toInterfaceConfig(privateKeyFile)
+	cfg, err := client.Spec.CommonSpec.toInterfaceConfig(privateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if client.Spec.Endpoint != "" {
+		port, err := endpointPort(client.Spec.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ListenPort = &port
+	}
+	return cfg, nil
+}
+
+// Meshes reports whether the client peers with other mesh clients of its network
+func (client *Client) Meshes(network *Network) bool {
+	return client.Spec.Mesh || (network != nil && network.Spec.Topology == FullMesh)
 }
 
 func (client *Client) NodeName() string {
 	return client.ObjectMeta.Name
 }
 
+func (client *Client) GetCommonSpec() *CommonSpec {
+	return &client.Spec.CommonSpec
+}
+
+func (client *Client) GetCommonStatus() *CommonStatus {
+	return &client.Status.CommonStatus
+}
+
 // ClientStatus defines the observed state of Client
 // +k8s:openapi-gen=true
 type ClientStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
+
+	CommonStatus `json:",inline"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
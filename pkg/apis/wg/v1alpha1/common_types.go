@@ -4,49 +4,244 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/mdlayher/wireguardctrl/wgtypes"
 	"github.com/nmiculinic/wg-quick-go"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type VPNNode interface {
-	ToPeerConfig() (wgtypes.PeerConfig, error)
+	runtime.Object
+	metav1.Object
+	ToPeerConfigs(resolve Resolver) ([]wgtypes.PeerConfig, error)
 	ToInterfaceConfig(privateKeyFile string) (*wgquick.Config, error)
 	NodeName() string
+	GetCommonSpec() *CommonSpec
+	GetCommonStatus() *CommonStatus
+	Default()
+	Validate() error
 	isNode()
 }
 
+// Resolver resolves a host:port endpoint. A nil address leaves the peer's current endpoint in place
+type Resolver func(endpoint string) (*net.UDPAddr, error)
+
+// ResolveEndpoint resolves the endpoint right away
+func ResolveEndpoint(endpoint string) (*net.UDPAddr, error) {
+	return net.ResolveUDPAddr("udp", endpoint)
+}
+
+// endpointPort returns the port of a host:port endpoint without resolving the host
+func endpointPort(endpoint string) (int, error) {
+	_, port, err := splitEndpoint(endpoint)
+	return port, err
+}
+
+// splitEndpoint splits a host:port endpoint. IPv6 hosts must be in brackets, e.g. [2001:db8::1]:51820,
+// and may carry a zone for link-local addresses
+func splitEndpoint(endpoint string) (host string, port int, err error) {
+	host, p, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		if strings.Count(endpoint, ":") > 1 && !strings.HasPrefix(endpoint, "[") {
+			return "", 0, fmt.Errorf("IPv6 host of endpoint %s must be in brackets, e.g. [2001:db8::1]:51820", endpoint)
+		}
+		return "", 0, fmt.Errorf("endpoint %s must be host:port", endpoint)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("host of endpoint %s must not be empty", endpoint)
+	}
+	if strings.HasPrefix(endpoint, "[") {
+		if ip := net.ParseIP(strings.SplitN(host, "%", 2)[0]); ip == nil || ip.To4() != nil {
+			return "", 0, fmt.Errorf("only IPv6 hosts of endpoint %s may be in brackets", endpoint)
+		}
+	}
+	port, err = strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("port of endpoint %s must be between 1 and 65535", endpoint)
+	}
+	return host, port, nil
+}
+
 type CommonSpec struct {
-	PublicKey string   `json:"publicKey"`
-	Addresses []string `json:"addresses"`
-	DNS       []string `json:"dns,omitempty"`
-	// Each Address/32 is appended to allowedIPs
-	AllowedIPs []string `json:"allowedIPs"`
+	// PublicKey of the node. The agent fills it in when running with --generate-private-key
+	PublicKey string `json:"publicKey,omitempty"`
+	// PendingPublicKey is the node's next public key during key rotation. Peers add it alongside PublicKey
+	// and acknowledge it in their status, after which the node switches over to it.
+	PendingPublicKey string `json:"pendingPublicKey,omitempty"`
+	// Addresses of the node, IPv4, IPv6 or both. Plain addresses are /32 or /128. When empty and AddressPool is set, the controller allocates them
+	Addresses []string `json:"addresses,omitempty"`
+	// AddressPool to allocate Addresses from, defaults to the network's pool
+	AddressPool string `json:"addressPool,omitempty"`
+	// Network the node belongs to. Nodes only peer within their network, nodes without one form the default network
+	Network string   `json:"network,omitempty"`
+	DNS     []string `json:"dns,omitempty"`
+	// Each Address is appended to allowedIPs as a host route, unless already covered
+	AllowedIPs []string `json:"allowedIPs,omitempty"`
 	PreUp      string   `json:"preUp,omitempty"`
 	PostUp     string   `json:"postUp,omitempty"`
 	PreDown    string   `json:"preDown,omitempty"`
 	PostDown   string   `json:"postDown,omitempty"`
 	MTU        int      `json:"mtu,omitempty"`
 	Table      int      `json:"table,omitempty"`
+	// PersistentKeepalive in seconds the node sends towards its peers, 0 disables it. Overrides the network's setting
+	PersistentKeepalive *int `json:"persistentKeepalive,omitempty"`
+}
+
+// PresharedKeySpec selects the Secrets holding preshared keys between a server and its peers.
+// A Secret labeled with PSKServerLabel and PSKPeerLabel for the pair takes precedence over SecretName.
+// Between two servers, the settings of the server whose name sorts first apply.
+// +k8s:openapi-gen=true
+type PresharedKeySpec struct {
+	// SecretName of a Secret holding the key shared by all peers of this server
+	SecretName string `json:"secretName,omitempty"`
+	// Key in the Secret's data, defaults to PSKSecretKey
+	Key string `json:"key,omitempty"`
+	// PerPair makes the controller generate and rotate a dedicated Secret for each peer of this server
+	PerPair bool `json:"perPair,omitempty"`
 }
 
+const (
+	// PSKServerLabel marks a per pair preshared key Secret with the server's name
+	PSKServerLabel = "wg.krakensystems.co/psk-server"
+	// PSKPeerLabel marks a per pair preshared key Secret with the peer's name
+	PSKPeerLabel = "wg.krakensystems.co/psk-peer"
+	// PSKSecretKey is the default Secret data key holding the base64 encoded preshared key
+	PSKSecretKey = "presharedKey"
+	// PSKNextSecretKey holds the key a generated Secret is rotating to. Both sides of the pair switch over to it
+	// at the time in PSKActivateAtAnnotation
+	PSKNextSecretKey = "nextPresharedKey"
+	// PSKActivateAtAnnotation is when the next preshared key of a generated Secret takes effect, RFC 3339
+	PSKActivateAtAnnotation = "wg.krakensystems.co/psk-activate-at"
+	// NodeLabel assigns a Server or Client to the agent of the named host, besides the one named after the host
+	NodeLabel = "wg.krakensystems.co/node"
+)
+
+// OwnsPresharedKey reports whether server a's PresharedKeySpec applies to the pair of servers a and b
+func OwnsPresharedKey(a, b string) bool {
+	return a < b
+}
+
+// SameNetwork reports whether both nodes belong to the same network
+func SameNetwork(a, b VPNNode) bool {
+	return a.GetCommonSpec().Network == b.GetCommonSpec().Network
+}
+
+// Peers reports whether the server and the client are in the same network and select each other, and should be peered
+func Peers(server *Server, client *Client) (bool, error) {
+	if !SameNetwork(server, client) {
+		return false, nil
+	}
+	ok, err := selects(server.Spec.ClientSelector, client.Labels)
+	if err != nil || !ok {
+		return false, err
+	}
+	return selects(client.Spec.ServerSelector, server.Labels)
+}
+
+// selects matches the labels against the selector. A nil selector selects everything
+func selects(selector *metav1.LabelSelector, l map[string]string) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	return s.Matches(labels.Set(l)), nil
+}
+
+// PeerStatus is the observed state of a single wireguard peer as seen from this node
+// +k8s:openapi-gen=true
+type PeerStatus struct {
+	// Name of the Server or Client this peer was generated from
+	Name              string       `json:"name"`
+	PublicKey         string       `json:"publicKey"`
+	Endpoint          string       `json:"endpoint,omitempty"`
+	LastHandshakeTime *metav1.Time `json:"lastHandshakeTime,omitempty"`
+	ReceiveBytes      int64        `json:"receiveBytes"`
+	TransmitBytes     int64        `json:"transmitBytes"`
+	// Online is true if the last handshake is recent enough for the session to be alive
+	Online bool `json:"online"`
+}
+
+// CommonStatus is the observed state shared by Servers and Clients. It's written by the agent running on the node.
+type CommonStatus struct {
+	Peers       []PeerStatus `json:"peers,omitempty"`
+	OnlinePeers int          `json:"onlinePeers"`
+	TotalPeers  int          `json:"totalPeers"`
+	// Most recent handshake across all peers
+	LastHandshakeTime *metav1.Time `json:"lastHandshakeTime,omitempty"`
+	LastUpdateTime    *metav1.Time `json:"lastUpdateTime,omitempty"`
+	Conditions        []Condition  `json:"conditions,omitempty"`
+	// AcknowledgedKeys are pending public keys of peers this node has configured
+	AcknowledgedKeys []string `json:"acknowledgedKeys,omitempty"`
+	// KeyRotationTrigger is the last processed value of the rotate-key annotation
+	KeyRotationTrigger string `json:"keyRotationTrigger,omitempty"`
+	// KeyRotationStartTime is when the current pending key was published
+	KeyRotationStartTime *metav1.Time `json:"keyRotationStartTime,omitempty"`
+	// LastKeyRotationTime is when the node last switched over to a new key
+	LastKeyRotationTime *metav1.Time `json:"lastKeyRotationTime,omitempty"`
+}
+
+// RotateKeyAnnotation triggers key rotation on the node whenever its value changes
+const RotateKeyAnnotation = "wg.krakensystems.co/rotate-key"
+
+// HostRoutesAnnotation lists the host routes defaulting added to allowedIPs, comma separated, so they're replaced
+// rather than kept once the addresses change
+const HostRoutesAnnotation = "wg.krakensystems.co/host-routes"
+
+// InterfaceFinalizer holds a node's CR until its agent has taken down the node's interfaces
+const InterfaceFinalizer = "wg.krakensystems.co/interface"
+
+// parseAddress parses an IP address or CIDR, keeping the host bits. An address without a prefix is a host
+// route of its family, /32 or /128. IPv4 addresses come out 4 bytes long
 func parseAddress(addr string) (*net.IPNet, error) {
-	if strings.Contains(addr, "/") {
-		ip, cidr, err := net.ParseCIDR(addr)
-		if err != nil {
-			return nil, err
+	if !strings.Contains(addr, "/") {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address: %s", addr)
 		}
-		return &net.IPNet{IP: ip, Mask: cidr.Mask}, nil
-	} else {
-		return parseAddress(addr + "/32")
+		ip = normalizeIP(ip)
+		bits := 8 * len(ip)
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	ip, cidr, err := net.ParseCIDR(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &net.IPNet{IP: normalizeIP(ip), Mask: cidr.Mask}, nil
+}
+
+// ParseCIDR parses an IP address or CIDR into the network it's in, a host route for a plain address
+func ParseCIDR(addr string) (*net.IPNet, error) {
+	n, err := parseAddress(addr)
+	if err != nil {
+		return nil, err
 	}
+	return &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}, nil
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// hostRoute is the allowed IP routing just the address
+func hostRoute(ip net.IP) string {
+	ip = normalizeIP(ip)
+	return fmt.Sprintf("%s/%d", ip, 8*len(ip))
 }
 
 func (common *CommonSpec) toPeerConfig() (wgtypes.PeerConfig, error) {
 	srvKey, err := wgquick.ParseKey(common.PublicKey)
 	if err != nil {
-		return wgtypes.PeerConfig{}, nil
+		return wgtypes.PeerConfig{}, fmt.Errorf("cannot parse public key: %v", err)
 	}
 	peer := wgtypes.PeerConfig{
 		ReplaceAllowedIPs: true,
@@ -64,6 +259,27 @@ func (common *CommonSpec) toPeerConfig() (wgtypes.PeerConfig, error) {
 	return peer, nil
 }
 
+// toPeerConfigs returns peer config for the public key, followed by the pending key's one if there is a rotation in progress
+func (common *CommonSpec) toPeerConfigs() ([]wgtypes.PeerConfig, error) {
+	peer, err := common.toPeerConfig()
+	if err != nil {
+		return nil, err
+	}
+	peers := []wgtypes.PeerConfig{peer}
+	if common.PendingPublicKey != "" {
+		key, err := wgquick.ParseKey(common.PendingPublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse pending public key: %v", err)
+		}
+		// allowed IP can belong to a single peer only, pending key gets them once it's promoted
+		peers = append(peers, wgtypes.PeerConfig{
+			ReplaceAllowedIPs: true,
+			PublicKey:         key,
+		})
+	}
+	return peers, nil
+}
+
 func (common *CommonSpec) toInterfaceConfig(privateKeyFile string) (*wgquick.Config, error) {
 	pkey, err := ioutil.ReadFile(privateKeyFile)
 	if err != nil {
@@ -83,8 +299,18 @@ func (common *CommonSpec) toInterfaceConfig(privateKeyFile string) (*wgquick.Con
 		addrs = append(addrs, *a)
 	}
 
+	var dns []net.IP
+	for _, d := range common.DNS {
+		ip := net.ParseIP(d)
+		if ip == nil {
+			return nil, fmt.Errorf("cannot parse dns %s", d)
+		}
+		dns = append(dns, ip)
+	}
+
 	cfg := wgquick.Config{
 		Address: addrs,
+		DNS:     dns,
 		Config: wgtypes.Config{
 			PrivateKey:   &key,
 			ReplacePeers: true,
@@ -1,11 +1,21 @@
 package v1alpha1
 
 import (
+	"io/ioutil"
 	"net"
+	"os"
 	"reflect"
 	"testing"
 )
 
+func cidr(ip string, ones, bits int) *net.IPNet {
+	addr := net.ParseIP(ip)
+	if v4 := addr.To4(); v4 != nil {
+		addr = v4
+	}
+	return &net.IPNet{IP: addr, Mask: net.CIDRMask(ones, bits)}
+}
+
 func Test_parseAddress(t *testing.T) {
 	type args struct {
 		addr string
@@ -16,7 +26,22 @@ func Test_parseAddress(t *testing.T) {
 		want    *net.IPNet
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{"ipv4 host", args{"10.0.0.1"}, cidr("10.0.0.1", 32, 32), false},
+		{"ipv4 cidr keeps host bits", args{"10.0.0.1/24"}, cidr("10.0.0.1", 24, 32), false},
+		{"ipv4 network", args{"10.0.0.0/8"}, cidr("10.0.0.0", 8, 32), false},
+		{"ipv4 default route", args{"0.0.0.0/0"}, cidr("0.0.0.0", 0, 32), false},
+		{"ipv6 host", args{"fd00::1"}, cidr("fd00::1", 128, 128), false},
+		{"ipv6 cidr keeps host bits", args{"fd00::1/64"}, cidr("fd00::1", 64, 128), false},
+		{"ipv6 default route", args{"::/0"}, cidr("::", 0, 128), false},
+		{"ipv6 full form", args{"2001:0db8:0000:0000:0000:0000:0000:0001"}, cidr("2001:db8::1", 128, 128), false},
+		{"ipv4-mapped ipv6 is ipv4", args{"::ffff:10.0.0.1"}, cidr("10.0.0.1", 32, 32), false},
+		{"ipv4 prefix too long", args{"10.0.0.1/33"}, nil, true},
+		{"ipv6 prefix too long", args{"fd00::1/129"}, nil, true},
+		{"bad ipv4", args{"10.0.0.300"}, nil, true},
+		{"bad ipv6", args{"fd00::1::2"}, nil, true},
+		{"bracketed ipv6", args{"[fd00::1]"}, nil, true},
+		{"hostname", args{"vpn.example.com"}, nil, true},
+		{"empty", args{""}, nil, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -31,3 +56,160 @@ func Test_parseAddress(t *testing.T) {
 		})
 	}
 }
+
+func Test_hostRoute(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.0.0.1", "10.0.0.1/32"},
+		{"::ffff:10.0.0.1", "10.0.0.1/32"},
+		{"fd00::1", "fd00::1/128"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := hostRoute(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("hostRoute() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{"hostname", "vpn.example.com:51820", "vpn.example.com", 51820, false},
+		{"ipv4", "192.0.2.1:51820", "192.0.2.1", 51820, false},
+		{"ipv6", "[2001:db8::1]:51820", "2001:db8::1", 51820, false},
+		{"ipv6 with zone", "[fe80::1%eth0]:51820", "fe80::1%eth0", 51820, false},
+		{"ipv6 without brackets", "2001:db8::1:51820", "", 0, true},
+		{"ipv6 without port", "[2001:db8::1]", "", 0, true},
+		{"bracketed ipv4", "[192.0.2.1]:51820", "", 0, true},
+		{"bracketed hostname", "[vpn.example.com]:51820", "", 0, true},
+		{"no port", "vpn.example.com", "", 0, true},
+		{"empty host", ":51820", "", 0, true},
+		{"port zero", "vpn.example.com:0", "", 0, true},
+		{"port out of range", "[2001:db8::1]:70000", "", 0, true},
+		{"named port", "vpn.example.com:wireguard", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, err := splitEndpoint(tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("splitEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("splitEndpoint() = %s, %d, want %s, %d", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestCommonSpec_toPeerConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		want       []net.IPNet
+		wantErr    bool
+	}{
+		{"ipv4", []string{"10.0.0.1/32"}, []net.IPNet{*cidr("10.0.0.1", 32, 32)}, false},
+		{"ipv6", []string{"fd00::1/128"}, []net.IPNet{*cidr("fd00::1", 128, 128)}, false},
+		{"dual-stack", []string{"10.0.0.0/24", "fd00::/64"}, []net.IPNet{*cidr("10.0.0.0", 24, 32), *cidr("fd00::", 64, 128)}, false},
+		{"dual-stack default routes", []string{"0.0.0.0/0", "::/0"}, []net.IPNet{*cidr("0.0.0.0", 0, 32), *cidr("::", 0, 128)}, false},
+		{"host bits are masked", []string{"10.0.0.5/24", "fd00::5/64"}, []net.IPNet{*cidr("10.0.0.0", 24, 32), *cidr("fd00::", 64, 128)}, false},
+		{"bare addresses are host routes", []string{"10.0.0.5", "fd00::5"}, []net.IPNet{*cidr("10.0.0.5", 32, 32), *cidr("fd00::5", 128, 128)}, false},
+		{"invalid", []string{"fd00::/129"}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			common := &CommonSpec{PublicKey: testKey, AllowedIPs: tt.allowedIPs}
+			got, err := common.toPeerConfig()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("toPeerConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got.AllowedIPs, tt.want) {
+				t.Errorf("toPeerConfig() allowedIPs = %v, want %v", got.AllowedIPs, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ToInterfaceConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "wg-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(testKey); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		name      string
+		addresses []string
+		endpoint  string
+		want      []net.IPNet
+		wantPort  int
+		wantErr   bool
+	}{
+		{"ipv4", []string{"10.0.0.2/24"}, "", []net.IPNet{*cidr("10.0.0.2", 24, 32)}, 0, false},
+		{"ipv6", []string{"fd00::2"}, "[2001:db8::2]:51821", []net.IPNet{*cidr("fd00::2", 128, 128)}, 51821, false},
+		{"dual-stack", []string{"10.0.0.2/24", "fd00::2/64"}, "192.0.2.2:51820", []net.IPNet{*cidr("10.0.0.2", 24, 32), *cidr("fd00::2", 64, 128)}, 51820, false},
+		{"unbracketed ipv6 endpoint", []string{"fd00::2"}, "2001:db8::2:51821", nil, 0, true},
+		{"bad address", []string{"fd00::2/200"}, "", nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{Spec: ClientSpec{CommonSpec: CommonSpec{Addresses: tt.addresses}, Endpoint: tt.endpoint}}
+			cfg, err := c.ToInterfaceConfig(f.Name())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ToInterfaceConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(cfg.Address, tt.want) {
+				t.Errorf("ToInterfaceConfig() addresses = %v, want %v", cfg.Address, tt.want)
+			}
+			port := 0
+			if cfg.ListenPort != nil {
+				port = *cfg.ListenPort
+			}
+			if port != tt.wantPort {
+				t.Errorf("ToInterfaceConfig() listen port = %d, want %d", port, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestServer_ToPeerConfigs(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		want     string
+	}{
+		{"ipv4", "192.0.2.1:51820", "192.0.2.1:51820"},
+		{"ipv6", "[2001:db8::1]:51820", "[2001:db8::1]:51820"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{Spec: ServerSpec{CommonSpec: CommonSpec{PublicKey: testKey}, Endpoint: tt.endpoint}}
+			peers, err := s.ToPeerConfigs(ResolveEndpoint)
+			if err != nil {
+				t.Fatalf("ToPeerConfigs() error = %v", err)
+			}
+			if got := peers[0].Endpoint.String(); got != tt.want {
+				t.Errorf("ToPeerConfigs() endpoint = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
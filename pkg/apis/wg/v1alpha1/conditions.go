@@ -0,0 +1,64 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type ConditionType string
+
+const (
+	// ConditionReady is true when the node's interface is configured with the latest spec and is up
+	ConditionReady ConditionType = "Ready"
+	// ConditionSynced is true when the last sync of the node's configuration succeeded
+	ConditionSynced ConditionType = "Synced"
+	// ConditionDegraded is true when the node runs an older configuration because the latest one couldn't be applied
+	ConditionDegraded ConditionType = "Degraded"
+	// ConditionKeyMismatch is true when the published public key doesn't match the node's private key
+	ConditionKeyMismatch ConditionType = "KeyMismatch"
+	// ConditionEndpointsResolved is false when some peer endpoint hostnames can't be resolved
+	ConditionEndpointsResolved ConditionType = "EndpointsResolved"
+)
+
+// Condition describes one aspect of the node's state
+// +k8s:openapi-gen=true
+type Condition struct {
+	Type   ConditionType          `json:"type"`
+	Status corev1.ConditionStatus `json:"status"`
+	// Reason is a CamelCase machine readable reason for the condition's last transition
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+	// LastTransitionTime is the last time the condition changed its status
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+	// ObservedGeneration is the metadata.generation the condition was computed for
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// GetCondition returns the condition of a given type, or nil if it's not set
+func GetCondition(conditions []Condition, t ConditionType) *Condition {
+	for i := range conditions {
+		if conditions[i].Type == t {
+			return &conditions[i]
+		}
+	}
+	return nil
+}
+
+// SetCondition adds or updates the condition. LastTransitionTime is only bumped when the status changes.
+func SetCondition(conditions *[]Condition, c Condition) {
+	existing := GetCondition(*conditions, c.Type)
+	if existing == nil {
+		if c.LastTransitionTime.IsZero() {
+			c.LastTransitionTime = metav1.Now()
+		}
+		*conditions = append(*conditions, c)
+		return
+	}
+	if existing.Status != c.Status {
+		existing.Status = c.Status
+		existing.LastTransitionTime = metav1.Now()
+	}
+	existing.Reason = c.Reason
+	existing.Message = c.Message
+	existing.ObservedGeneration = c.ObservedGeneration
+}
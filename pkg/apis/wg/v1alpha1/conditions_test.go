@@ -0,0 +1,49 @@
+package v1alpha1
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	before := metav1.NewTime(time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC))
+	tests := []struct {
+		name           string
+		existing       []Condition
+		set            Condition
+		wantTransition bool
+	}{
+		{"added", nil, Condition{Type: ConditionReady, Status: corev1.ConditionTrue, Reason: "Synced"}, true},
+		{"same status", []Condition{{Type: ConditionReady, Status: corev1.ConditionTrue, Reason: "Synced", LastTransitionTime: before}},
+			Condition{Type: ConditionReady, Status: corev1.ConditionTrue, Reason: "Synced", Message: "again", ObservedGeneration: 2}, false},
+		{"reason only", []Condition{{Type: ConditionReady, Status: corev1.ConditionFalse, Reason: "NeverSynced", LastTransitionTime: before}},
+			Condition{Type: ConditionReady, Status: corev1.ConditionFalse, Reason: "ApplyFailed", ObservedGeneration: 2}, false},
+		{"flipped", []Condition{{Type: ConditionReady, Status: corev1.ConditionFalse, Reason: "ApplyFailed", LastTransitionTime: before}},
+			Condition{Type: ConditionReady, Status: corev1.ConditionTrue, Reason: "Synced", ObservedGeneration: 2}, true},
+		{"other type", []Condition{{Type: ConditionSynced, Status: corev1.ConditionTrue, LastTransitionTime: before}},
+			Condition{Type: ConditionReady, Status: corev1.ConditionTrue}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditions := append([]Condition(nil), tt.existing...)
+			SetCondition(&conditions, tt.set)
+			got := GetCondition(conditions, tt.set.Type)
+			if got == nil {
+				t.Fatalf("condition %s not set", tt.set.Type)
+			}
+			if got.Status != tt.set.Status || got.Reason != tt.set.Reason || got.Message != tt.set.Message ||
+				got.ObservedGeneration != tt.set.ObservedGeneration {
+				t.Errorf("condition = %+v, want %+v", *got, tt.set)
+			}
+			if transitioned := !got.LastTransitionTime.Equal(&before); transitioned != tt.wantTransition {
+				t.Errorf("LastTransitionTime = %v, transitioned %v, want %v", got.LastTransitionTime, transitioned, tt.wantTransition)
+			}
+			if len(conditions) != len(tt.existing) && GetCondition(tt.existing, tt.set.Type) != nil {
+				t.Errorf("conditions = %v, want the existing one updated", conditions)
+			}
+		})
+	}
+}
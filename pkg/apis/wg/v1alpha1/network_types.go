@@ -0,0 +1,59 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Topology decides which nodes of a network peer with each other
+type Topology string
+
+const (
+	// HubAndSpoke peers clients with servers only, unless they set mesh themselves
+	HubAndSpoke Topology = "HubAndSpoke"
+	// FullMesh additionally peers every client of the network with every other one
+	FullMesh Topology = "Mesh"
+)
+
+// NetworkSpec defines the desired state of Network. Member nodes inherit these settings unless they set their own
+// +k8s:openapi-gen=true
+type NetworkSpec struct {
+	// Interface the network is configured on, defaults to the agent's --wg-interface
+	Interface string `json:"interface,omitempty"`
+	// AddressPool addresses of member nodes are allocated from, unless they reference a pool themselves
+	AddressPool string   `json:"addressPool,omitempty"`
+	MTU         int      `json:"mtu,omitempty"`
+	DNS         []string `json:"dns,omitempty"`
+	// PersistentKeepalive in seconds member nodes send towards their peers, 0 disables it. By default only
+	// keepalives towards servers and from mesh clients without an endpoint are sent, every 25 seconds
+	PersistentKeepalive *int `json:"persistentKeepalive,omitempty"`
+	// ListenPort of member clients without an endpoint. Servers listen on their endpoint's port
+	ListenPort int `json:"listenPort,omitempty"`
+	// Topology of the network, HubAndSpoke or Mesh. Defaults to HubAndSpoke
+	// +kubebuilder:validation:Enum=HubAndSpoke,Mesh
+	Topology Topology `json:"topology,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Network is the Schema for the networks API. Servers and clients join it through spec.network,
+// and only peer with nodes of the same network
+// +k8s:openapi-gen=true
+type Network struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec NetworkSpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// NetworkList contains a list of Network
+type NetworkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Network `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Network{}, &NetworkList{})
+}
@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PeerPolicySpec defines the desired state of PeerPolicy. A client selected by any policy is isolated: through
+// the servers it peers with, it only reaches the destinations the policies selecting it allow. Clients no policy
+// selects reach everything
+// +k8s:openapi-gen=true
+type PeerPolicySpec struct {
+	// ClientSelector selects the clients the policy applies to. An empty selector selects all clients
+	ClientSelector metav1.LabelSelector `json:"clientSelector"`
+	// ServerSelector limits the servers enforcing the policy, all servers by default
+	ServerSelector *metav1.LabelSelector `json:"serverSelector,omitempty"`
+	// Egress lists the destinations the clients may reach. Without any, they reach nothing through the servers
+	Egress []PeerPolicyRule `json:"egress,omitempty"`
+}
+
+// PeerPolicyRule allows traffic to the CIDRs on the ports
+// +k8s:openapi-gen=true
+type PeerPolicyRule struct {
+	// CIDRs the clients may reach, any destination by default
+	CIDRs []string `json:"cidrs,omitempty"`
+	// Ports the clients may reach, all ports and protocols by default
+	Ports []PeerPolicyPort `json:"ports,omitempty"`
+}
+
+// PeerPolicyPort is a port or range of ports
+// +k8s:openapi-gen=true
+type PeerPolicyPort struct {
+	// Protocol, TCP, UDP or SCTP. Defaults to TCP
+	// +kubebuilder:validation:Enum=TCP,UDP,SCTP
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+	// Port, all ports of the protocol if 0
+	Port int `json:"port,omitempty"`
+	// EndPort makes the rule cover the range from Port to EndPort
+	EndPort int `json:"endPort,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PeerPolicy is the Schema for the peerpolicies API. Servers enforce it on their wireguard interface,
+// so it doesn't cover traffic between mesh clients
+// +k8s:openapi-gen=true
+type PeerPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec PeerPolicySpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// PeerPolicyList contains a list of PeerPolicy
+type PeerPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PeerPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PeerPolicy{}, &PeerPolicyList{})
+}
+
+// Applies reports whether the policy applies to the client on the server
+func (p *PeerPolicy) Applies(server *Server, client *Client) (bool, error) {
+	ok, err := selects(&p.Spec.ClientSelector, client.Labels)
+	if err != nil || !ok {
+		return false, err
+	}
+	return selects(p.Spec.ServerSelector, server.Labels)
+}
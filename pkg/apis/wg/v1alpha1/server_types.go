@@ -1,11 +1,13 @@
 package v1alpha1
 
 import (
+	"fmt"
 	"net"
 	"time"
 
 	"github.com/mdlayher/wireguardctrl/wgtypes"
 	"github.com/nmiculinic/wg-quick-go"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -20,25 +22,122 @@ type ServerSpec struct {
 	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
 
 	CommonSpec `json:",inline"`
-	Endpoint   string `json:"endpoint"`
+	// Endpoint peers connect to, host:port or [IPv6]:port. Either Endpoint or EndpointFrom has to be set
+	Endpoint string `json:"endpoint,omitempty"`
+	// EndpointFrom derives the endpoint from a Service or Node. The server's agent keeps it current in status.endpoint
+	EndpointFrom *EndpointSource `json:"endpointFrom,omitempty"`
+	// PresharedKey configures preshared keys between this server and its peers
+	PresharedKey *PresharedKeySpec `json:"presharedKey,omitempty"`
+	// ClientSelector limits the clients peering with this server, all clients by default
+	ClientSelector *metav1.LabelSelector `json:"clientSelector,omitempty"`
+	// Masquerade makes the server NAT its peers' traffic leaving towards other networks, and enables forwarding
+	Masquerade *MasqueradeSpec `json:"masquerade,omitempty"`
 }
 
+// MasqueradeSpec selects the traffic the server's agent masquerades in its own nftables tables
+// +k8s:openapi-gen=true
+type MasqueradeSpec struct {
+	// EgressInterface the traffic leaves through, any interface but the wireguard one by default
+	EgressInterface string `json:"egressInterface,omitempty"`
+	// SourceCIDRs of the masqueraded traffic, defaults to the subnets of the server's addresses
+	SourceCIDRs []string `json:"sourceCIDRs,omitempty"`
+}
+
+// EndpointSource references the object a server's endpoint is derived from. Exactly one of Service and Node is set
+// +k8s:openapi-gen=true
+type EndpointSource struct {
+	Service *ServiceEndpointSource `json:"service,omitempty"`
+	Node    *NodeEndpointSource    `json:"node,omitempty"`
+}
+
+// ServiceEndpointSource reaches the server through a Service in its namespace. A LoadBalancer Service is reached
+// on its ingress IP or hostname, a NodePort Service on the node port of a Node's address.
+// The server listens on the port's numeric targetPort, or the port itself
+// +k8s:openapi-gen=true
+type ServiceEndpointSource struct {
+	Name string `json:"name"`
+	// Port name of the Service, defaults to its first port
+	Port string `json:"port,omitempty"`
+	// NodeName a NodePort Service is reached on, defaults to the server's own node
+	NodeName string `json:"nodeName,omitempty"`
+	// AddressType of the Node's address a NodePort Service is reached on
+	// +kubebuilder:validation:Enum=ExternalIP,InternalIP
+	AddressType corev1.NodeAddressType `json:"addressType,omitempty"`
+}
+
+// NodeEndpointSource reaches the server on a Node's address
+// +k8s:openapi-gen=true
+type NodeEndpointSource struct {
+	// Name of the Node, defaults to the server's own node
+	Name string `json:"name,omitempty"`
+	// AddressType of the Node's address, ExternalIP or InternalIP. Defaults to ExternalIP, falling back to InternalIP
+	// +kubebuilder:validation:Enum=ExternalIP,InternalIP
+	AddressType corev1.NodeAddressType `json:"addressType,omitempty"`
+	// Port the server listens on
+	Port int `json:"port"`
+}
+
+// HostNode is the Kubernetes Node the server runs on, its NodeLabel or otherwise its name
+func (server *Server) HostNode() string {
+	if n := server.Labels[NodeLabel]; n != "" {
+		return n
+	}
+	return server.Name
+}
+
+// GetEndpoint returns the endpoint peers connect to, empty if it's derived and not known yet
+func (server *Server) GetEndpoint() string {
+	if server.Spec.Endpoint != "" {
+		return server.Spec.Endpoint
+	}
+	return server.Status.Endpoint
+}
+
+// MasqueradeSources returns the CIDRs the server masquerades, the subnets of its addresses unless set
+func (server *Server) MasqueradeSources() ([]*net.IPNet, error) {
+	if server.Spec.Masquerade == nil {
+		return nil, nil
+	}
+	cidrs := server.Spec.Masquerade.SourceCIDRs
+	if len(cidrs) == 0 {
+		cidrs = server.Spec.Addresses
+	}
+	var sources []*net.IPNet
+	for _, c := range cidrs {
+		n, err := ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse masquerade source %s: %v", c, err)
+		}
+		sources = append(sources, n)
+	}
+	return sources, nil
+}
+
+// DefaultPersistentKeepalive is sent towards servers, unless the node or its network sets its own
+const DefaultPersistentKeepalive = 25 * time.Second
+
 var _ VPNNode = (*Server)(nil)
 
 func (*Server) isNode() {}
 
-func (server *Server) ToPeerConfig() (wgtypes.PeerConfig, error) {
-	peer, err := server.Spec.CommonSpec.toPeerConfig()
+func (server *Server) ToPeerConfigs(resolve Resolver) ([]wgtypes.PeerConfig, error) {
+	peers, err := server.Spec.CommonSpec.toPeerConfigs()
 	if err != nil {
-		return wgtypes.PeerConfig{}, err
+		return nil, err
 	}
-	peer.Endpoint, err = net.ResolveUDPAddr("", server.Spec.Endpoint)
-	keepAlive := 25 * time.Second
-	peer.PersistentKeepaliveInterval = &keepAlive
+	if server.GetEndpoint() == "" {
+		return peers, nil
+	}
+	endpoint, err := resolve(server.GetEndpoint())
 	if err != nil {
-		return wgtypes.PeerConfig{}, err
+		return nil, err
 	}
-	return peer, nil
+	keepAlive := DefaultPersistentKeepalive
+	for i := range peers {
+		peers[i].Endpoint = endpoint
+		peers[i].PersistentKeepaliveInterval = &keepAlive
+	}
+	return peers, nil
 }
 
 func (server *Server) ToInterfaceConfig(privateKeyFile string) (*wgquick.Config, error) {
@@ -46,11 +145,14 @@ func (server *Server) ToInterfaceConfig(privateKeyFile string) (*wgquick.Config,
 	if err != nil {
 		return nil, err
 	}
-	ep, err := net.ResolveUDPAddr("", server.Spec.Endpoint)
-	if err != nil {
-		return nil, err
+	// with EndpointFrom the agent fills in the port
+	if server.Spec.Endpoint != "" {
+		port, err := endpointPort(server.Spec.Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ListenPort = &port
 	}
-	cfg.ListenPort = &ep.Port
 	return cfg, nil
 }
 
@@ -58,12 +160,24 @@ func (server *Server) NodeName() string {
 	return server.ObjectMeta.Name
 }
 
+func (server *Server) GetCommonSpec() *CommonSpec {
+	return &server.Spec.CommonSpec
+}
+
+func (server *Server) GetCommonStatus() *CommonStatus {
+	return &server.Status.CommonStatus
+}
+
 // ServerStatus defines the observed state of Server
 // +k8s:openapi-gen=true
 type ServerStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "operator-sdk generate k8s" to regenerate code after modifying this file
 	// Add custom validation using kubebuilder tags: https://book.kubebuilder.io/beyond_basics/generating_crd.html
+
+	CommonStatus `json:",inline"`
+	// Endpoint derived from spec.endpointFrom
+	Endpoint string `json:"endpoint,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -0,0 +1,334 @@
+package v1alpha1
+
+import (
+	"encoding/base64"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// MinMTU is the smallest MTU IPv4 guarantees to carry
+	MinMTU = 576
+	// MaxMTU is the largest MTU a wireguard interface accepts
+	MaxMTU = 65535
+	// MaxPersistentKeepalive is the longest keepalive interval wireguard accepts, in seconds
+	MaxPersistentKeepalive = 65535
+	// maxInterfaceNameLength is IFNAMSIZ without the terminating null byte
+	maxInterfaceNameLength = 15
+	// maxHookLength limits PreUp/PostUp/PreDown/PostDown commands
+	maxHookLength = 4096
+	// lastAppliedAnnotation duplicates the whole object, which is validated on its own
+	lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+)
+
+// keyLike matches base64 encoded 32 byte strings, such as wireguard private, public and preshared keys
+var keyLike = regexp.MustCompile(`[A-Za-z0-9+/]{42}[AEIMQUYcgkosw048]=`)
+
+func validateKey(path *field.Path, key string) *field.Error {
+	b, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return field.Invalid(path, key, "must be base64 encoded: "+err.Error())
+	}
+	if len(b) != 32 {
+		return field.Invalid(path, key, "must be 32 bytes long, got "+strconv.Itoa(len(b)))
+	}
+	return nil
+}
+
+func validateAddresses(path *field.Path, addrs []string) field.ErrorList {
+	var errs field.ErrorList
+	for i, a := range addrs {
+		if _, err := parseAddress(a); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), a, "must be an IP address or CIDR"))
+		}
+	}
+	return errs
+}
+
+func validateHook(path *field.Path, hook string) *field.Error {
+	if len(hook) > maxHookLength {
+		return field.TooLong(path, hook, maxHookLength)
+	}
+	// hooks are written into a line based wg-quick config file
+	if strings.ContainsAny(hook, "\r\n\x00") {
+		return field.Invalid(path, hook, "must be a single line")
+	}
+	return nil
+}
+
+// validateEndpoint checks the endpoint is host:port. The host isn't resolved, it may not be resolvable from the apiserver
+func validateEndpoint(path *field.Path, endpoint string) *field.Error {
+	if _, _, err := splitEndpoint(endpoint); err != nil {
+		return field.Invalid(path, endpoint, err.Error())
+	}
+	return nil
+}
+
+func validateInterfaceName(path *field.Path, name string) *field.Error {
+	if len(name) > maxInterfaceNameLength {
+		return field.TooLong(path, name, maxInterfaceNameLength)
+	}
+	if name == "." || name == ".." || strings.ContainsAny(name, "/: \t\n\x00\"") {
+		return field.Invalid(path, name, "must be a valid network interface name")
+	}
+	return nil
+}
+
+func validateMasquerade(path *field.Path, m *MasqueradeSpec) field.ErrorList {
+	var errs field.ErrorList
+	if m.EgressInterface != "" {
+		if err := validateInterfaceName(path.Child("egressInterface"), m.EgressInterface); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, c := range m.SourceCIDRs {
+		if _, _, err := net.ParseCIDR(c); err != nil {
+			errs = append(errs, field.Invalid(path.Child("sourceCIDRs").Index(i), c, "must be a CIDR"))
+		}
+	}
+	return errs
+}
+
+func validateAddressType(path *field.Path, t corev1.NodeAddressType) *field.Error {
+	switch t {
+	case "", corev1.NodeExternalIP, corev1.NodeInternalIP:
+		return nil
+	}
+	return field.NotSupported(path, t, []string{string(corev1.NodeExternalIP), string(corev1.NodeInternalIP)})
+}
+
+func validateEndpointSource(path *field.Path, src *EndpointSource) field.ErrorList {
+	var errs field.ErrorList
+	switch {
+	case src.Service != nil && src.Node != nil:
+		errs = append(errs, field.Invalid(path, src, "only one of service and node may be set"))
+	case src.Service != nil:
+		if src.Service.Name == "" {
+			errs = append(errs, field.Required(path.Child("service", "name"), ""))
+		}
+		if err := validateAddressType(path.Child("service", "addressType"), src.Service.AddressType); err != nil {
+			errs = append(errs, err)
+		}
+	case src.Node != nil:
+		if src.Node.Port < 1 || src.Node.Port > 65535 {
+			errs = append(errs, field.Invalid(path.Child("node", "port"), src.Node.Port, "must be between 1 and 65535"))
+		}
+		if err := validateAddressType(path.Child("node", "addressType"), src.Node.AddressType); err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		errs = append(errs, field.Required(path, "one of service and node must be set"))
+	}
+	return errs
+}
+
+func (common *CommonSpec) validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if common.PublicKey != "" {
+		if err := validateKey(path.Child("publicKey"), common.PublicKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if common.PendingPublicKey != "" {
+		if err := validateKey(path.Child("pendingPublicKey"), common.PendingPublicKey); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	errs = append(errs, validateAddresses(path.Child("addresses"), common.Addresses)...)
+	errs = append(errs, validateAddresses(path.Child("allowedIPs"), common.AllowedIPs)...)
+	for i, dns := range common.DNS {
+		if net.ParseIP(dns) == nil {
+			errs = append(errs, field.Invalid(path.Child("dns").Index(i), dns, "must be an IP address"))
+		}
+	}
+	if common.MTU != 0 && (common.MTU < MinMTU || common.MTU > MaxMTU) {
+		errs = append(errs, field.Invalid(path.Child("mtu"), common.MTU, "must be between "+strconv.Itoa(MinMTU)+" and "+strconv.Itoa(MaxMTU)))
+	}
+	if common.Table < 0 {
+		errs = append(errs, field.Invalid(path.Child("table"), common.Table, "must not be negative"))
+	}
+	if k := common.PersistentKeepalive; k != nil && (*k < 0 || *k > MaxPersistentKeepalive) {
+		errs = append(errs, field.Invalid(path.Child("persistentKeepalive"), *k, "must be between 0 and "+strconv.Itoa(MaxPersistentKeepalive)))
+	}
+	hooks := []struct{ name, hook string }{
+		{"preUp", common.PreUp}, {"postUp", common.PostUp}, {"preDown", common.PreDown}, {"postDown", common.PostDown},
+	}
+	for _, h := range hooks {
+		if err := validateHook(path.Child(h.name), h.hook); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func validateSelector(path *field.Path, selector *metav1.LabelSelector) *field.Error {
+	if selector == nil {
+		return nil
+	}
+	if _, err := metav1.LabelSelectorAsSelector(selector); err != nil {
+		return field.Invalid(path, selector, err.Error())
+	}
+	return nil
+}
+
+// validateAnnotations rejects annotations which look like they hold a private key. Any key-like value
+// other than the node's own public keys is rejected, since a private key can't be told apart from a public one
+func validateAnnotations(path *field.Path, meta metav1.Object, common *CommonSpec) field.ErrorList {
+	var errs field.ErrorList
+	for k, v := range meta.GetAnnotations() {
+		if k == lastAppliedAnnotation {
+			continue
+		}
+		lk := strings.ToLower(k)
+		if strings.Contains(lk, "priv") && strings.Contains(lk, "key") {
+			errs = append(errs, field.Forbidden(path.Key(k), "annotation looks like it holds a private key"))
+			continue
+		}
+		for _, key := range keyLike.FindAllString(v, -1) {
+			if key != common.PublicKey && key != common.PendingPublicKey {
+				errs = append(errs, field.Forbidden(path.Key(k), "annotation contains key material other than the node's public key"))
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// defaultHostRoutes appends each address as a host route to allowedIPs, unless it's already covered. The host
+// routes added before, recorded in HostRoutesAnnotation, are dropped first, so the ones of former addresses go
+func defaultHostRoutes(meta metav1.Object, common *CommonSpec) {
+	annotations := meta.GetAnnotations()
+	generated := make(map[string]bool)
+	if v := annotations[HostRoutesAnnotation]; v != "" {
+		for _, r := range strings.Split(v, ",") {
+			generated[r] = true
+		}
+	}
+	var allowedIPs []string
+	for _, allowed := range common.AllowedIPs {
+		if !generated[allowed] {
+			allowedIPs = append(allowedIPs, allowed)
+		}
+	}
+
+	var routes []string
+	for _, addr := range common.Addresses {
+		a, err := parseAddress(addr)
+		if err != nil {
+			continue
+		}
+		covered := false
+		for _, allowed := range allowedIPs {
+			if c, err := parseAddress(allowed); err == nil && (&net.IPNet{IP: c.IP.Mask(c.Mask), Mask: c.Mask}).Contains(a.IP) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			routes = append(routes, hostRoute(a.IP))
+		}
+	}
+	common.AllowedIPs = append(allowedIPs, routes...)
+
+	if len(routes) == 0 {
+		delete(annotations, HostRoutesAnnotation)
+		return
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[HostRoutesAnnotation] = strings.Join(routes, ",")
+	meta.SetAnnotations(annotations)
+}
+
+// Default sets defaults for unset fields
+func (s *Server) Default() {
+	defaultHostRoutes(s, &s.Spec.CommonSpec)
+}
+
+// Validate returns all problems with the server, or nil if it's valid
+func (s *Server) Validate() error {
+	spec := field.NewPath("spec")
+	errs := s.Spec.CommonSpec.validate(spec)
+	switch {
+	case s.Spec.Endpoint != "" && s.Spec.EndpointFrom != nil:
+		errs = append(errs, field.Invalid(spec.Child("endpointFrom"), s.Spec.EndpointFrom, "must not be set together with endpoint"))
+	case s.Spec.EndpointFrom != nil:
+		errs = append(errs, validateEndpointSource(spec.Child("endpointFrom"), s.Spec.EndpointFrom)...)
+	default:
+		if err := validateEndpoint(spec.Child("endpoint"), s.Spec.Endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateSelector(spec.Child("clientSelector"), s.Spec.ClientSelector); err != nil {
+		errs = append(errs, err)
+	}
+	if s.Spec.Masquerade != nil {
+		errs = append(errs, validateMasquerade(spec.Child("masquerade"), s.Spec.Masquerade)...)
+	}
+	errs = append(errs, validateAnnotations(field.NewPath("metadata", "annotations"), s, &s.Spec.CommonSpec)...)
+	return errs.ToAggregate()
+}
+
+// Default sets defaults for unset fields
+func (c *Client) Default() {
+	defaultHostRoutes(c, &c.Spec.CommonSpec)
+}
+
+// Validate returns all problems with the client, or nil if it's valid
+func (c *Client) Validate() error {
+	spec := field.NewPath("spec")
+	errs := c.Spec.CommonSpec.validate(spec)
+	if c.Spec.Endpoint != "" {
+		if err := validateEndpoint(spec.Child("endpoint"), c.Spec.Endpoint); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateSelector(spec.Child("serverSelector"), c.Spec.ServerSelector); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, validateAnnotations(field.NewPath("metadata", "annotations"), c, &c.Spec.CommonSpec)...)
+	return errs.ToAggregate()
+}
+
+func validatePolicyPort(path *field.Path, p PeerPolicyPort) field.ErrorList {
+	var errs field.ErrorList
+	switch p.Protocol {
+	case "", corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+	default:
+		errs = append(errs, field.NotSupported(path.Child("protocol"), p.Protocol, []string{string(corev1.ProtocolTCP), string(corev1.ProtocolUDP), string(corev1.ProtocolSCTP)}))
+	}
+	if p.Port < 0 || p.Port > 65535 {
+		errs = append(errs, field.Invalid(path.Child("port"), p.Port, "must be between 0 and 65535"))
+	}
+	if p.EndPort != 0 && (p.Port == 0 || p.EndPort < p.Port || p.EndPort > 65535) {
+		errs = append(errs, field.Invalid(path.Child("endPort"), p.EndPort, "must be between port and 65535"))
+	}
+	return errs
+}
+
+// Validate returns all problems with the policy, or nil if it's valid
+func (p *PeerPolicy) Validate() error {
+	spec := field.NewPath("spec")
+	var errs field.ErrorList
+	if err := validateSelector(spec.Child("clientSelector"), &p.Spec.ClientSelector); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateSelector(spec.Child("serverSelector"), p.Spec.ServerSelector); err != nil {
+		errs = append(errs, err)
+	}
+	for i, rule := range p.Spec.Egress {
+		path := spec.Child("egress").Index(i)
+		errs = append(errs, validateAddresses(path.Child("cidrs"), rule.CIDRs)...)
+		for j, port := range rule.Ports {
+			errs = append(errs, validatePolicyPort(path.Child("ports").Index(j), port)...)
+		}
+	}
+	return errs.ToAggregate()
+}
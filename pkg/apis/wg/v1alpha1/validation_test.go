@@ -0,0 +1,162 @@
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testKey = "oj/x/PIWqBGgE7NQqtum4ZD+2vruwRmcuTl8/VWwPnc="
+
+func TestServer_Validate(t *testing.T) {
+	valid := func() *Server {
+		return &Server{Spec: ServerSpec{
+			CommonSpec: CommonSpec{
+				PublicKey:  testKey,
+				Addresses:  []string{"10.0.0.1/24"},
+				AllowedIPs: []string{"10.0.0.0/24"},
+				MTU:        1420,
+				PostUp:     "iptables -A FORWARD -i %i -j ACCEPT",
+			},
+			Endpoint: "vpn.example.com:51820",
+		}}
+	}
+	tests := []struct {
+		name    string
+		mutate  func(s *Server)
+		wantErr bool
+	}{
+		{"valid", func(s *Server) {}, false},
+		{"no public key yet", func(s *Server) { s.Spec.PublicKey = "" }, false},
+		{"short key", func(s *Server) { s.Spec.PublicKey = "Zm9vYmFy" }, true},
+		{"not base64", func(s *Server) { s.Spec.PublicKey = "not a key" }, true},
+		{"bad pending key", func(s *Server) { s.Spec.PendingPublicKey = "Zm9vYmFy" }, true},
+		{"bad address", func(s *Server) { s.Spec.Addresses = []string{"10.0.0.300"} }, true},
+		{"bad allowed ip", func(s *Server) { s.Spec.AllowedIPs = []string{"10.0.0.0/33"} }, true},
+		{"ipv6 endpoint", func(s *Server) { s.Spec.Endpoint = "[fd00::1]:51820" }, false},
+		{"unbracketed ipv6 endpoint", func(s *Server) { s.Spec.Endpoint = "fd00::1:51820" }, true},
+		{"dual-stack", func(s *Server) {
+			s.Spec.Addresses = []string{"10.0.0.1/24", "fd00::1/64"}
+			s.Spec.AllowedIPs = []string{"10.0.0.0/24", "fd00::/64"}
+		}, false},
+		{"bad ipv6 allowed ip", func(s *Server) { s.Spec.AllowedIPs = []string{"fd00::/129"} }, true},
+		{"endpoint without port", func(s *Server) { s.Spec.Endpoint = "vpn.example.com" }, true},
+		{"endpoint port out of range", func(s *Server) { s.Spec.Endpoint = "vpn.example.com:70000" }, true},
+		{"endpoint from service", func(s *Server) {
+			s.Spec.Endpoint = ""
+			s.Spec.EndpointFrom = &EndpointSource{Service: &ServiceEndpointSource{Name: "wg"}}
+		}, false},
+		{"endpoint and endpoint from", func(s *Server) {
+			s.Spec.EndpointFrom = &EndpointSource{Node: &NodeEndpointSource{Port: 51820}}
+		}, true},
+		{"endpoint from node without port", func(s *Server) {
+			s.Spec.Endpoint = ""
+			s.Spec.EndpointFrom = &EndpointSource{Node: &NodeEndpointSource{Name: "node-1"}}
+		}, true},
+		{"empty endpoint from", func(s *Server) { s.Spec.Endpoint = ""; s.Spec.EndpointFrom = &EndpointSource{} }, true},
+		{"masquerade", func(s *Server) {
+			s.Spec.Masquerade = &MasqueradeSpec{EgressInterface: "eth0", SourceCIDRs: []string{"10.0.0.0/24", "fd00::/64"}}
+		}, false},
+		{"masquerade defaults", func(s *Server) { s.Spec.Masquerade = &MasqueradeSpec{} }, false},
+		{"masquerade bad egress interface", func(s *Server) { s.Spec.Masquerade = &MasqueradeSpec{EgressInterface: "eth0; drop"} }, true},
+		{"masquerade egress interface too long", func(s *Server) {
+			s.Spec.Masquerade = &MasqueradeSpec{EgressInterface: "averyverylongname"}
+		}, true},
+		{"masquerade source without prefix", func(s *Server) { s.Spec.Masquerade = &MasqueradeSpec{SourceCIDRs: []string{"10.0.0.1"}} }, true},
+		{"mtu too small", func(s *Server) { s.Spec.MTU = 100 }, true},
+		{"keepalive disabled", func(s *Server) { k := 0; s.Spec.PersistentKeepalive = &k }, false},
+		{"keepalive too long", func(s *Server) { k := 70000; s.Spec.PersistentKeepalive = &k }, true},
+		{"multiline hook", func(s *Server) { s.Spec.PreUp = "true\nPrivateKey = foo" }, true},
+		{"own public key in annotation", func(s *Server) { s.Annotations = map[string]string{"note": "key " + testKey} }, false},
+		{"private key annotation", func(s *Server) { s.Annotations = map[string]string{"priv-key": "secret"} }, true},
+		{"foreign key in annotation", func(s *Server) {
+			s.Annotations = map[string]string{"note": "CG9hQWXc0zyo8GCNshT3K/6tt0XbVtuAT8oXQ9/igFc="}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := valid()
+			tt.mutate(s)
+			if err := s.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_Default(t *testing.T) {
+	tests := []struct {
+		name          string
+		addresses     []string
+		allowedIPs    []string
+		generated     string
+		want          []string
+		wantGenerated string
+	}{
+		{"appends host route", []string{"10.0.0.5"}, nil, "", []string{"10.0.0.5/32"}, "10.0.0.5/32"},
+		{"address with prefix", []string{"10.0.0.5/24"}, []string{"192.168.0.0/16"}, "", []string{"192.168.0.0/16", "10.0.0.5/32"}, "10.0.0.5/32"},
+		{"already covered", []string{"10.0.0.5/24"}, []string{"10.0.0.0/24"}, "", []string{"10.0.0.0/24"}, ""},
+		{"ipv6", []string{"fd00::5/64"}, nil, "", []string{"fd00::5/128"}, "fd00::5/128"},
+		{"bare ipv6", []string{"fd00::5"}, nil, "", []string{"fd00::5/128"}, "fd00::5/128"},
+		{"dual-stack", []string{"10.0.0.5/24", "fd00::5/64"}, nil, "", []string{"10.0.0.5/32", "fd00::5/128"}, "10.0.0.5/32,fd00::5/128"},
+		{"dual-stack partly covered", []string{"10.0.0.5/24", "fd00::5/64"}, []string{"fd00::/64"}, "", []string{"fd00::/64", "10.0.0.5/32"}, "10.0.0.5/32"},
+		{"defaulted again", []string{"10.0.0.5"}, []string{"10.0.0.5/32"}, "10.0.0.5/32", []string{"10.0.0.5/32"}, "10.0.0.5/32"},
+		{"address changed", []string{"10.0.0.6"}, []string{"192.168.0.0/16", "10.0.0.5/32"}, "10.0.0.5/32", []string{"192.168.0.0/16", "10.0.0.6/32"}, "10.0.0.6/32"},
+		{"address removed", nil, []string{"10.0.0.5/32"}, "10.0.0.5/32", nil, ""},
+		{"now covered", []string{"10.0.0.5"}, []string{"10.0.0.5/32", "10.0.0.0/24"}, "10.0.0.5/32", []string{"10.0.0.0/24"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{ObjectMeta: metav1.ObjectMeta{Name: "c"}, Spec: ClientSpec{CommonSpec: CommonSpec{Addresses: tt.addresses, AllowedIPs: tt.allowedIPs}}}
+			if tt.generated != "" {
+				c.Annotations = map[string]string{HostRoutesAnnotation: tt.generated}
+			}
+			c.Default()
+			if !reflect.DeepEqual(c.Spec.AllowedIPs, tt.want) {
+				t.Errorf("Default() allowedIPs = %v, want %v", c.Spec.AllowedIPs, tt.want)
+			}
+			if got := c.Annotations[HostRoutesAnnotation]; got != tt.wantGenerated {
+				t.Errorf("Default() host routes annotation = %q, want %q", got, tt.wantGenerated)
+			}
+		})
+	}
+}
+
+func TestPeerPolicy_Validate(t *testing.T) {
+	valid := func() *PeerPolicy {
+		return &PeerPolicy{Spec: PeerPolicySpec{
+			ClientSelector: metav1.LabelSelector{MatchLabels: map[string]string{"role": "contractor"}},
+			Egress: []PeerPolicyRule{{
+				CIDRs: []string{"10.20.0.0/16", "fd00:20::/64"},
+				Ports: []PeerPolicyPort{{Port: 443}, {Protocol: "UDP", Port: 53}, {Port: 8000, EndPort: 8080}},
+			}},
+		}}
+	}
+	tests := []struct {
+		name    string
+		mutate  func(p *PeerPolicy)
+		wantErr bool
+	}{
+		{"valid", func(p *PeerPolicy) {}, false},
+		{"deny all", func(p *PeerPolicy) { p.Spec.Egress = nil }, false},
+		{"any destination", func(p *PeerPolicy) { p.Spec.Egress[0].CIDRs = nil }, false},
+		{"bad cidr", func(p *PeerPolicy) { p.Spec.Egress[0].CIDRs = []string{"10.20.0.0/33"} }, true},
+		{"bad protocol", func(p *PeerPolicy) { p.Spec.Egress[0].Ports[0].Protocol = "ICMP" }, true},
+		{"port out of range", func(p *PeerPolicy) { p.Spec.Egress[0].Ports[0].Port = 70000 }, true},
+		{"end port before port", func(p *PeerPolicy) { p.Spec.Egress[0].Ports[2].EndPort = 7000 }, true},
+		{"end port without port", func(p *PeerPolicy) { p.Spec.Egress[0].Ports[0] = PeerPolicyPort{EndPort: 80} }, true},
+		{"bad selector", func(p *PeerPolicy) {
+			p.Spec.ClientSelector.MatchExpressions = []metav1.LabelSelectorRequirement{{Key: "role", Operator: "Maybe"}}
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.mutate(p)
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -13,12 +13,280 @@ import (
 
 func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
 	return map[string]common.OpenAPIDefinition{
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Client":       schema_pkg_apis_wg_v1alpha1_Client(ref),
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec":   schema_pkg_apis_wg_v1alpha1_ClientSpec(ref),
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus": schema_pkg_apis_wg_v1alpha1_ClientStatus(ref),
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Server":       schema_pkg_apis_wg_v1alpha1_Server(ref),
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServerSpec":   schema_pkg_apis_wg_v1alpha1_ServerSpec(ref),
-		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServerStatus": schema_pkg_apis_wg_v1alpha1_ServerStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressAllocation":     schema_pkg_apis_wg_v1alpha1_AddressAllocation(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilySettings": schema_pkg_apis_wg_v1alpha1_AddressFamilySettings(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilyStatus":   schema_pkg_apis_wg_v1alpha1_AddressFamilyStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPool":           schema_pkg_apis_wg_v1alpha1_AddressPool(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolSpec":       schema_pkg_apis_wg_v1alpha1_AddressPoolSpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolStatus":     schema_pkg_apis_wg_v1alpha1_AddressPoolStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Client":                schema_pkg_apis_wg_v1alpha1_Client(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec":            schema_pkg_apis_wg_v1alpha1_ClientSpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus":          schema_pkg_apis_wg_v1alpha1_ClientStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Condition":             schema_pkg_apis_wg_v1alpha1_Condition(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.EndpointSource":        schema_pkg_apis_wg_v1alpha1_EndpointSource(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.MasqueradeSpec":        schema_pkg_apis_wg_v1alpha1_MasqueradeSpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Network":               schema_pkg_apis_wg_v1alpha1_Network(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NetworkSpec":           schema_pkg_apis_wg_v1alpha1_NetworkSpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NodeEndpointSource":    schema_pkg_apis_wg_v1alpha1_NodeEndpointSource(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicy":            schema_pkg_apis_wg_v1alpha1_PeerPolicy(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyPort":        schema_pkg_apis_wg_v1alpha1_PeerPolicyPort(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyRule":        schema_pkg_apis_wg_v1alpha1_PeerPolicyRule(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicySpec":        schema_pkg_apis_wg_v1alpha1_PeerPolicySpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerStatus":            schema_pkg_apis_wg_v1alpha1_PeerStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PresharedKeySpec":      schema_pkg_apis_wg_v1alpha1_PresharedKeySpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Server":                schema_pkg_apis_wg_v1alpha1_Server(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServerSpec":            schema_pkg_apis_wg_v1alpha1_ServerSpec(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServerStatus":          schema_pkg_apis_wg_v1alpha1_ServerStatus(ref),
+		"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServiceEndpointSource": schema_pkg_apis_wg_v1alpha1_ServiceEndpointSource(ref),
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressAllocation(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressAllocation records an address in use by a node",
+				Properties: map[string]spec.Schema{
+					"address": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind of the node, Server or Client",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+				},
+				Required: []string{"address", "kind", "name"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressFamilySettings(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressFamilySettings tunes allocation for one address family",
+				Properties: map[string]spec.Schema{
+					"disabled": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Disabled skips allocation from this family's CIDRs",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"prefixLength": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PrefixLength written on allocated addresses. Defaults to a host prefix, /32 or /128",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressFamilyStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressFamilyStatus reports pool usage for a single address family",
+				Properties: map[string]spec.Schema{
+					"family": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Family is either IPv4 or IPv6",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"capacity": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Capacity is the number of allocatable addresses. It's a string since IPv6 pools overflow int64",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"allocated": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"utilization": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+				},
+				Required: []string{"family", "capacity", "allocated", "utilization"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressPool(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressPool is the Schema for the addresspools API",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolSpec", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressPoolStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressPoolSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressPoolSpec defines the desired state of AddressPool",
+				Properties: map[string]spec.Schema{
+					"cidrs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CIDRs addresses are allocated from. IPv4 and IPv6 CIDRs can be mixed, nodes get an address from each family",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"reserved": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reserved addresses or CIDRs which are never allocated, e.g. statically addressed servers",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"ipv4": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilySettings"),
+						},
+					},
+					"ipv6": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilySettings"),
+						},
+					},
+				},
+				Required: []string{"cidrs"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilySettings"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_AddressPoolStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "AddressPoolStatus defines the observed state of AddressPool",
+				Properties: map[string]spec.Schema{
+					"families": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilyStatus"),
+									},
+								},
+							},
+						},
+					},
+					"allocations": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressAllocation"),
+									},
+								},
+							},
+						},
+					},
+					"allocated": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Allocated addresses across all families",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"utilization": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Utilization of the fullest family in percent",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"allocated"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressAllocation", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.AddressFamilyStatus"},
 	}
 }
 
@@ -26,7 +294,542 @@ func schema_pkg_apis_wg_v1alpha1_Client(ref common.ReferenceCallback) common.Ope
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "Client is the Schema for the clients API",
+				Description: "Client is the Schema for the clients API",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec"),
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_ClientSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClientSpec defines the desired state of Client",
+				Properties: map[string]spec.Schema{
+					"publicKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PublicKey of the node. The agent fills it in when running with --generate-private-key",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pendingPublicKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PendingPublicKey is the node's next public key during key rotation. Peers add it alongside PublicKey and acknowledge it in their status, after which the node switches over to it.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"addresses": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Addresses of the node, IPv4, IPv6 or both. Plain addresses are /32 or /128. When empty and AddressPool is set, the controller allocates them",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"addressPool": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AddressPool to allocate Addresses from, defaults to the network's pool",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"network": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Network the node belongs to. Nodes only peer within their network, nodes without one form the default network",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"dns": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"allowedIPs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Each Address is appended to allowedIPs as a host route, unless already covered",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"preUp": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"postUp": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"preDown": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"postDown": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"mtu": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"table": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"persistentKeepalive": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PersistentKeepalive in seconds the node sends towards its peers, 0 disables it. Overrides the network's setting",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint other nodes can reach this client on, host:port. Optional, mesh clients without one are only reachable once they initiate the handshake",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"mesh": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Mesh makes the client peer directly with every other mesh client, not only with servers. All clients of a network with the Mesh topology are mesh clients",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"serverSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ServerSelector limits the servers this client peers with, all servers by default",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_ClientStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ClientStatus defines the observed state of Client",
+				Properties: map[string]spec.Schema{
+					"peers": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerStatus"),
+									},
+								},
+							},
+						},
+					},
+					"onlinePeers": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"totalPeers": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"lastHandshakeTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Most recent handshake across all peers",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastUpdateTime": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Condition"),
+									},
+								},
+							},
+						},
+					},
+					"acknowledgedKeys": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AcknowledgedKeys are pending public keys of peers this node has configured",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"keyRotationTrigger": {
+						SchemaProps: spec.SchemaProps{
+							Description: "KeyRotationTrigger is the last processed value of the rotate-key annotation",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"keyRotationStartTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "KeyRotationStartTime is when the current pending key was published",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastKeyRotationTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastKeyRotationTime is when the node last switched over to a new key",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+				},
+				Required: []string{"onlinePeers", "totalPeers"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Condition", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_Condition(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Condition describes one aspect of the node's state",
+				Properties: map[string]spec.Schema{
+					"type": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"status": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"reason": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Reason is a CamelCase machine readable reason for the condition's last transition",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"message": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"lastTransitionTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastTransitionTime is the last time the condition changed its status",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"observedGeneration": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ObservedGeneration is the metadata.generation the condition was computed for",
+							Type:        []string{"integer"},
+							Format:      "int64",
+						},
+					},
+				},
+				Required: []string{"type", "status"},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_EndpointSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "EndpointSource references the object a server's endpoint is derived from. Exactly one of Service and Node is set",
+				Properties: map[string]spec.Schema{
+					"service": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServiceEndpointSource"),
+						},
+					},
+					"node": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NodeEndpointSource"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NodeEndpointSource", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ServiceEndpointSource"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_MasqueradeSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "MasqueradeSpec selects the traffic the server's agent masquerades in its own nftables tables",
+				Properties: map[string]spec.Schema{
+					"egressInterface": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EgressInterface the traffic leaves through, any interface but the wireguard one by default",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sourceCIDRs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SourceCIDRs of the masqueraded traffic, defaults to the subnets of the server's addresses",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_Network(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Network is the Schema for the networks API. Servers and clients join it through spec.network, and only peer with nodes of the same network",
+				Properties: map[string]spec.Schema{
+					"kind": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Kind is a string value representing the REST resource this object represents. Servers may infer this from the endpoint the client submits requests to. Cannot be updated. In CamelCase. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#types-kinds",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"apiVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "APIVersion defines the versioned schema of this representation of an object. Servers should convert recognized schemas to the latest internal value, and may reject unrecognized values. More info: https://git.k8s.io/community/contributors/devel/api-conventions.md#resources",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"metadata": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"),
+						},
+					},
+					"spec": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NetworkSpec"),
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.NetworkSpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_NetworkSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NetworkSpec defines the desired state of Network. Member nodes inherit these settings unless they set their own",
+				Properties: map[string]spec.Schema{
+					"interface": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Interface the network is configured on, defaults to the agent's --wg-interface",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"addressPool": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AddressPool addresses of member nodes are allocated from, unless they reference a pool themselves",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"mtu": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"dns": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"persistentKeepalive": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PersistentKeepalive in seconds member nodes send towards their peers, 0 disables it. By default only keepalives towards servers and from mesh clients without an endpoint are sent, every 25 seconds",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"listenPort": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ListenPort of member clients without an endpoint. Servers listen on their endpoint's port",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"topology": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Topology of the network, HubAndSpoke or Mesh. Defaults to HubAndSpoke",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_NodeEndpointSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "NodeEndpointSource reaches the server on a Node's address",
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Name of the Node, defaults to the server's own node",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"addressType": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AddressType of the Node's address, ExternalIP or InternalIP. Defaults to ExternalIP, falling back to InternalIP",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port the server listens on",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"port"},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_PeerPolicy(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PeerPolicy is the Schema for the peerpolicies API. Servers enforce it on their wireguard interface, so it doesn't cover traffic between mesh clients",
 				Properties: map[string]spec.Schema{
 					"kind": {
 						SchemaProps: spec.SchemaProps{
@@ -49,37 +852,61 @@ func schema_pkg_apis_wg_v1alpha1_Client(ref common.ReferenceCallback) common.Ope
 					},
 					"spec": {
 						SchemaProps: spec.SchemaProps{
-							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec"),
-						},
-					},
-					"status": {
-						SchemaProps: spec.SchemaProps{
-							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus"),
+							Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicySpec"),
 						},
 					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientSpec", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.ClientStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicySpec", "k8s.io/apimachinery/pkg/apis/meta/v1.ObjectMeta"},
 	}
 }
 
-func schema_pkg_apis_wg_v1alpha1_ClientSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_wg_v1alpha1_PeerPolicyPort(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "ClientSpec defines the desired state of Client",
+				Description: "PeerPolicyPort is a port or range of ports",
 				Properties: map[string]spec.Schema{
-					"publicKey": {
+					"protocol": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "Protocol, TCP, UDP or SCTP. Defaults to TCP",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"addresses": {
+					"port": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
+							Description: "Port, all ports of the protocol if 0",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"endPort": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EndPort makes the rule cover the range from Port to EndPort",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_PeerPolicyRule(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PeerPolicyRule allows traffic to the CIDRs on the ports",
+				Properties: map[string]spec.Schema{
+					"cidrs": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CIDRs the clients may reach, any destination by default",
+							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
@@ -90,83 +917,153 @@ func schema_pkg_apis_wg_v1alpha1_ClientSpec(ref common.ReferenceCallback) common
 							},
 						},
 					},
-					"dns": {
+					"ports": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
+							Description: "Ports the clients may reach, all ports and protocols by default",
+							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
-										Type:   []string{"string"},
-										Format: "",
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyPort"),
 									},
 								},
 							},
 						},
 					},
-					"allowedIPs": {
+				},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyPort"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_PeerPolicySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PeerPolicySpec defines the desired state of PeerPolicy. A client selected by any policy is isolated: through the servers it peers with, it only reaches the destinations the policies selecting it allow. Clients no policy selects reach everything",
+				Properties: map[string]spec.Schema{
+					"clientSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientSelector selects the clients the policy applies to. An empty selector selects all clients",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
+					"serverSelector": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Each Address/32 is appended to allowedIPs",
+							Description: "ServerSelector limits the servers enforcing the policy, all servers by default",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
+					"egress": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Egress lists the destinations the clients may reach. Without any, they reach nothing through the servers",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
-										Type:   []string{"string"},
-										Format: "",
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyRule"),
 									},
 								},
 							},
 						},
 					},
-					"preUp": {
+				},
+				Required: []string{"clientSelector"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerPolicyRule", "k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_PeerStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PeerStatus is the observed state of a single wireguard peer as seen from this node",
+				Properties: map[string]spec.Schema{
+					"name": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "Name of the Server or Client this peer was generated from",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
-					"postUp": {
+					"publicKey": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"string"},
 							Format: "",
 						},
 					},
-					"preDown": {
+					"endpoint": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"string"},
 							Format: "",
 						},
 					},
-					"postDown": {
+					"lastHandshakeTime": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
 						},
 					},
-					"mtu": {
+					"receiveBytes": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"integer"},
-							Format: "int32",
+							Format: "int64",
 						},
 					},
-					"table": {
+					"transmitBytes": {
 						SchemaProps: spec.SchemaProps{
 							Type:   []string{"integer"},
-							Format: "int32",
+							Format: "int64",
+						},
+					},
+					"online": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Online is true if the last handshake is recent enough for the session to be alive",
+							Type:        []string{"boolean"},
+							Format:      "",
 						},
 					},
 				},
-				Required: []string{"publicKey", "addresses", "allowedIPs"},
+				Required: []string{"name", "publicKey", "receiveBytes", "transmitBytes", "online"},
 			},
 		},
-		Dependencies: []string{},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
 	}
 }
 
-func schema_pkg_apis_wg_v1alpha1_ClientStatus(ref common.ReferenceCallback) common.OpenAPIDefinition {
+func schema_pkg_apis_wg_v1alpha1_PresharedKeySpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
-				Description: "ClientStatus defines the observed state of Client",
-				Properties:  map[string]spec.Schema{},
+				Description: "PresharedKeySpec selects the Secrets holding preshared keys between a server and its peers. A Secret labeled with PSKServerLabel and PSKPeerLabel for the pair takes precedence over SecretName. Between two servers, the settings of the server whose name sorts first apply.",
+				Properties: map[string]spec.Schema{
+					"secretName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SecretName of a Secret holding the key shared by all peers of this server",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"key": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Key in the Secret's data, defaults to PSKSecretKey",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"perPair": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PerPair makes the controller generate and rotate a dedicated Secret for each peer of this server",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+				},
 			},
 		},
 		Dependencies: []string{},
@@ -224,13 +1121,22 @@ func schema_pkg_apis_wg_v1alpha1_ServerSpec(ref common.ReferenceCallback) common
 				Properties: map[string]spec.Schema{
 					"publicKey": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "PublicKey of the node. The agent fills it in when running with --generate-private-key",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"pendingPublicKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PendingPublicKey is the node's next public key during key rotation. Peers add it alongside PublicKey and acknowledge it in their status, after which the node switches over to it.",
+							Type:        []string{"string"},
+							Format:      "",
 						},
 					},
 					"addresses": {
 						SchemaProps: spec.SchemaProps{
-							Type: []string{"array"},
+							Description: "Addresses of the node, IPv4, IPv6 or both. Plain addresses are /32 or /128. When empty and AddressPool is set, the controller allocates them",
+							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
 									SchemaProps: spec.SchemaProps{
@@ -241,6 +1147,20 @@ func schema_pkg_apis_wg_v1alpha1_ServerSpec(ref common.ReferenceCallback) common
 							},
 						},
 					},
+					"addressPool": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AddressPool to allocate Addresses from, defaults to the network's pool",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"network": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Network the node belongs to. Nodes only peer within their network, nodes without one form the default network",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"dns": {
 						SchemaProps: spec.SchemaProps{
 							Type: []string{"array"},
@@ -256,7 +1176,7 @@ func schema_pkg_apis_wg_v1alpha1_ServerSpec(ref common.ReferenceCallback) common
 					},
 					"allowedIPs": {
 						SchemaProps: spec.SchemaProps{
-							Description: "Each Address/32 is appended to allowedIPs",
+							Description: "Each Address is appended to allowedIPs as a host route, unless already covered",
 							Type:        []string{"array"},
 							Items: &spec.SchemaOrArray{
 								Schema: &spec.Schema{
@@ -304,17 +1224,49 @@ func schema_pkg_apis_wg_v1alpha1_ServerSpec(ref common.ReferenceCallback) common
 							Format: "int32",
 						},
 					},
+					"persistentKeepalive": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PersistentKeepalive in seconds the node sends towards its peers, 0 disables it. Overrides the network's setting",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
 					"endpoint": {
 						SchemaProps: spec.SchemaProps{
-							Type:   []string{"string"},
-							Format: "",
+							Description: "Endpoint peers connect to, host:port or [IPv6]:port. Either Endpoint or EndpointFrom has to be set",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"endpointFrom": {
+						SchemaProps: spec.SchemaProps{
+							Description: "EndpointFrom derives the endpoint from a Service or Node. The server's agent keeps it current in status.endpoint",
+							Ref:         ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.EndpointSource"),
+						},
+					},
+					"presharedKey": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PresharedKey configures preshared keys between this server and its peers",
+							Ref:         ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PresharedKeySpec"),
+						},
+					},
+					"clientSelector": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ClientSelector limits the clients peering with this server, all clients by default",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"),
+						},
+					},
+					"masquerade": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Masquerade makes the server NAT its peers' traffic leaving towards other networks, and enables forwarding",
+							Ref:         ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.MasqueradeSpec"),
 						},
 					},
 				},
-				Required: []string{"publicKey", "addresses", "allowedIPs", "endpoint"},
 			},
 		},
-		Dependencies: []string{},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.EndpointSource", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.MasqueradeSpec", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PresharedKeySpec", "k8s.io/apimachinery/pkg/apis/meta/v1.LabelSelector"},
 	}
 }
 
@@ -323,7 +1275,138 @@ func schema_pkg_apis_wg_v1alpha1_ServerStatus(ref common.ReferenceCallback) comm
 		Schema: spec.Schema{
 			SchemaProps: spec.SchemaProps{
 				Description: "ServerStatus defines the observed state of Server",
-				Properties:  map[string]spec.Schema{},
+				Properties: map[string]spec.Schema{
+					"peers": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerStatus"),
+									},
+								},
+							},
+						},
+					},
+					"onlinePeers": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"totalPeers": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"integer"},
+							Format: "int32",
+						},
+					},
+					"lastHandshakeTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Most recent handshake across all peers",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastUpdateTime": {
+						SchemaProps: spec.SchemaProps{
+							Ref: ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"conditions": {
+						SchemaProps: spec.SchemaProps{
+							Type: []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Ref: ref("github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Condition"),
+									},
+								},
+							},
+						},
+					},
+					"acknowledgedKeys": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AcknowledgedKeys are pending public keys of peers this node has configured",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Type:   []string{"string"},
+										Format: "",
+									},
+								},
+							},
+						},
+					},
+					"keyRotationTrigger": {
+						SchemaProps: spec.SchemaProps{
+							Description: "KeyRotationTrigger is the last processed value of the rotate-key annotation",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"keyRotationStartTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "KeyRotationStartTime is when the current pending key was published",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"lastKeyRotationTime": {
+						SchemaProps: spec.SchemaProps{
+							Description: "LastKeyRotationTime is when the node last switched over to a new key",
+							Ref:         ref("k8s.io/apimachinery/pkg/apis/meta/v1.Time"),
+						},
+					},
+					"endpoint": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Endpoint derived from spec.endpointFrom",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"onlinePeers", "totalPeers"},
+			},
+		},
+		Dependencies: []string{
+			"github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.Condition", "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1.PeerStatus", "k8s.io/apimachinery/pkg/apis/meta/v1.Time"},
+	}
+}
+
+func schema_pkg_apis_wg_v1alpha1_ServiceEndpointSource(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "ServiceEndpointSource reaches the server through a Service in its namespace. A LoadBalancer Service is reached on its ingress IP or hostname, a NodePort Service on the node port of a Node's address. The server listens on the port's numeric targetPort, or the port itself",
+				Properties: map[string]spec.Schema{
+					"name": {
+						SchemaProps: spec.SchemaProps{
+							Type:   []string{"string"},
+							Format: "",
+						},
+					},
+					"port": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Port name of the Service, defaults to its first port",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"nodeName": {
+						SchemaProps: spec.SchemaProps{
+							Description: "NodeName a NodePort Service is reached on, defaults to the server's own node",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"addressType": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AddressType of the Node's address a NodePort Service is reached on",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+				},
+				Required: []string{"name"},
 			},
 		},
 		Dependencies: []string{},
@@ -0,0 +1,62 @@
+// Package backend applies wireguard configs to interfaces and reads their live state back. The kernel backend
+// drives the kernel module, the wireguard-go one runs the wireguard-go executable on a TUN device, and the file
+// one only renders the configs, while the fake keeps everything in memory for tests
+package backend
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Backend applies wireguard configs to interfaces and reads their live state. Errors about a missing interface
+// satisfy os.IsNotExist
+type Backend interface {
+	// Sync creates the interface if needed and brings its device, addresses and routes to the config
+	Sync(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error
+	// Down runs the config's hooks and removes the interface. A missing interface is no error
+	Down(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error
+	// Device reads the wireguard state of the interface
+	Device(iface string) (*wgtypes.Device, error)
+	// ConfigureDevice changes the wireguard state of the interface in place
+	ConfigureDevice(iface string, cfg wgtypes.Config) error
+	// Link reads the addresses of the interface, and its routes in the table installed with the protocol
+	Link(iface string, table, protocol int) (*Link, error)
+	// ConfiguresHost reports whether the backend configures the host's network, so firewall rules apply
+	ConfiguresHost() bool
+}
+
+// Link is the network configuration of an interface. Routes leave out default routes, which the kernel
+// reports without a destination
+type Link struct {
+	Addresses []net.IPNet
+	Routes    []net.IPNet
+}
+
+// Names of the backends
+const (
+	KernelName      = "kernel"
+	WireguardGoName = "wireguard-go"
+	FileName        = "file"
+)
+
+// New creates the backend of the name. The file backend renders the configs into configDir
+func New(name, configDir string) (Backend, error) {
+	switch name {
+	case KernelName:
+		return &Kernel{}, nil
+	case WireguardGoName:
+		b, err := NewWireguardGo()
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case FileName:
+		return &File{Fake: NewFake(), Dir: configDir}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %s, must be one of %s, %s or %s", name, KernelName, WireguardGoName, FileName)
+	}
+}
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+// Fake keeps the interfaces in memory: a synced config becomes the interface's state as is, and
+// ConfigureDevice changes it like the kernel would. It's safe for concurrent use
+type Fake struct {
+	// SyncErr, if set, fails syncs
+	SyncErr error
+
+	mu      sync.Mutex
+	devices map[string]*wgtypes.Device
+	links   map[string]*Link
+	configs map[string]wgquick.Config
+}
+
+var _ Backend = (*Fake)(nil)
+
+func NewFake() *Fake {
+	return &Fake{
+		devices: make(map[string]*wgtypes.Device),
+		links:   make(map[string]*Link),
+		configs: make(map[string]wgquick.Config),
+	}
+}
+
+func notExist(iface string) error {
+	return &os.PathError{Op: "device", Path: iface, Err: os.ErrNotExist}
+}
+
+func (f *Fake) Sync(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	if f.SyncErr != nil {
+		return f.SyncErr
+	}
+	dev := &wgtypes.Device{Name: iface}
+	if cfg.PrivateKey != nil {
+		dev.PrivateKey = *cfg.PrivateKey
+		dev.PublicKey = cfg.PrivateKey.PublicKey()
+	}
+	if cfg.ListenPort != nil {
+		dev.ListenPort = *cfg.ListenPort
+	}
+	for _, p := range cfg.Peers {
+		dev.Peers = append(dev.Peers, wgtypes.Peer{PublicKey: p.PublicKey})
+		configurePeer(&dev.Peers[len(dev.Peers)-1], p)
+	}
+
+	link := &Link{Addresses: append([]net.IPNet(nil), cfg.Address...)}
+	for _, p := range dev.Peers {
+		for _, n := range p.AllowedIPs {
+			if ones, _ := n.Mask.Size(); ones > 0 {
+				link.Routes = append(link.Routes, n)
+			}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.devices[iface] = dev
+	f.links[iface] = link
+	f.configs[iface] = *cfg
+	return nil
+}
+
+func (f *Fake) Down(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.devices, iface)
+	delete(f.links, iface)
+	delete(f.configs, iface)
+	return nil
+}
+
+func (f *Fake) Device(iface string) (*wgtypes.Device, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dev, ok := f.devices[iface]
+	if !ok {
+		return nil, notExist(iface)
+	}
+	cp := *dev
+	cp.Peers = append([]wgtypes.Peer(nil), dev.Peers...)
+	return &cp, nil
+}
+
+func (f *Fake) ConfigureDevice(iface string, cfg wgtypes.Config) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dev, ok := f.devices[iface]
+	if !ok {
+		return notExist(iface)
+	}
+	if cfg.PrivateKey != nil {
+		dev.PrivateKey = *cfg.PrivateKey
+		dev.PublicKey = cfg.PrivateKey.PublicKey()
+	}
+	if cfg.ListenPort != nil {
+		dev.ListenPort = *cfg.ListenPort
+	}
+	if cfg.ReplacePeers {
+		dev.Peers = nil
+	}
+	for _, pc := range cfg.Peers {
+		i := 0
+		for i < len(dev.Peers) && dev.Peers[i].PublicKey != pc.PublicKey {
+			i++
+		}
+		switch {
+		case i < len(dev.Peers) && pc.Remove:
+			dev.Peers = append(dev.Peers[:i], dev.Peers[i+1:]...)
+		case i < len(dev.Peers):
+			configurePeer(&dev.Peers[i], pc)
+		case !pc.Remove && !pc.UpdateOnly:
+			dev.Peers = append(dev.Peers, wgtypes.Peer{PublicKey: pc.PublicKey})
+			configurePeer(&dev.Peers[i], pc)
+		}
+	}
+	return nil
+}
+
+// configurePeer applies the peer config to the peer
+func configurePeer(p *wgtypes.Peer, pc wgtypes.PeerConfig) {
+	if pc.PresharedKey != nil {
+		p.PresharedKey = *pc.PresharedKey
+	}
+	if pc.Endpoint != nil {
+		p.Endpoint = pc.Endpoint
+	}
+	if pc.PersistentKeepaliveInterval != nil {
+		p.PersistentKeepaliveInterval = *pc.PersistentKeepaliveInterval
+	}
+	if pc.ReplaceAllowedIPs {
+		p.AllowedIPs = nil
+	}
+	for _, n := range pc.AllowedIPs {
+		p.AllowedIPs = append(p.AllowedIPs, net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask})
+	}
+}
+
+func (f *Fake) Link(iface string, table, protocol int) (*Link, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link, ok := f.links[iface]
+	if !ok {
+		return nil, notExist(iface)
+	}
+	return &Link{
+		Addresses: append([]net.IPNet(nil), link.Addresses...),
+		Routes:    append([]net.IPNet(nil), link.Routes...),
+	}, nil
+}
+
+func (f *Fake) ConfiguresHost() bool {
+	return false
+}
+
+// Config returns the config last synced to the interface
+func (f *Fake) Config(iface string) (wgquick.Config, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cfg, ok := f.configs[iface]
+	return cfg, ok
+}
+
+// Interfaces returns the interfaces which are up, sorted
+func (f *Fake) Interfaces() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []string
+	for iface := range f.devices {
+		out = append(out, iface)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// DeleteRoute removes a route from the interface, like someone running ip route del
+func (f *Fake) DeleteRoute(iface string, dst net.IPNet) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	link, ok := f.links[iface]
+	if !ok {
+		return
+	}
+	for i, r := range link.Routes {
+		if r.String() == dst.String() {
+			link.Routes = append(link.Routes[:i], link.Routes[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package backend
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFake(t *testing.T) {
+	cidr := func(c string) net.IPNet {
+		_, n, _ := net.ParseCIDR(c)
+		return *n
+	}
+	key := func() wgtypes.Key {
+		k, _ := wgtypes.GeneratePrivateKey()
+		return k.PublicKey()
+	}
+	a, b, c := key(), key(), key()
+	f := NewFake()
+	cfg := &wgquick.Config{
+		Address: []net.IPNet{{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(24, 32)}},
+		Peers: []wgtypes.PeerConfig{
+			{PublicKey: a, AllowedIPs: []net.IPNet{cidr("10.0.0.2/32")}},
+			{PublicKey: b, AllowedIPs: []net.IPNet{cidr("10.1.0.0/16"), cidr("0.0.0.0/0")}},
+		},
+	}
+	if err := f.Sync(cfg, "wg0", logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.Interfaces(); !reflect.DeepEqual(got, []string{"wg0"}) {
+		t.Errorf("Interfaces() = %v, want [wg0]", got)
+	}
+	link, err := f.Link("wg0", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []net.IPNet{cidr("10.0.0.2/32"), cidr("10.1.0.0/16")}; !reflect.DeepEqual(link.Routes, want) {
+		t.Errorf("Link().Routes = %v, want %v", link.Routes, want)
+	}
+
+	err = f.ConfigureDevice("wg0", wgtypes.Config{Peers: []wgtypes.PeerConfig{
+		{PublicKey: a, Remove: true},
+		{PublicKey: b, ReplaceAllowedIPs: true, AllowedIPs: []net.IPNet{cidr("10.2.0.0/16")}},
+		{PublicKey: c, UpdateOnly: true},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, err := f.Device("wg0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dev.Peers) != 1 || dev.Peers[0].PublicKey != b {
+		t.Fatalf("Device().Peers = %v, want only b", dev.Peers)
+	}
+	if want := []net.IPNet{cidr("10.2.0.0/16")}; !reflect.DeepEqual(dev.Peers[0].AllowedIPs, want) {
+		t.Errorf("allowed IPs = %v, want %v", dev.Peers[0].AllowedIPs, want)
+	}
+
+	if err := f.Down(cfg, "wg0", logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Device("wg0"); !os.IsNotExist(err) {
+		t.Errorf("Device() after Down error = %v, want not exist", err)
+	}
+	if _, err := f.Link("wg0", 0, 0); !os.IsNotExist(err) {
+		t.Errorf("Link() after Down error = %v, want not exist", err)
+	}
+}
@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+// File only renders the configs into Dir/<iface>.conf, for hosts where something else brings them up. It
+// reports the rendered configs as the interfaces' state
+type File struct {
+	*Fake
+	Dir string
+}
+
+var _ Backend = (*File)(nil)
+
+// Path is the file the interface's config is rendered into
+func (f *File) Path(iface string) string {
+	return path.Join(f.Dir, iface+".conf")
+}
+
+func (f *File) Sync(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	text, err := cfg.MarshalText()
+	if err != nil {
+		return fmt.Errorf("cannot marshal config: %v", err)
+	}
+	if err := ioutil.WriteFile(f.Path(iface), text, 0600); err != nil {
+		return fmt.Errorf("cannot write config: %v", err)
+	}
+	return f.Fake.Sync(cfg, iface, log)
+}
+
+func (f *File) Down(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	if err := os.Remove(f.Path(iface)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot remove config: %v", err)
+	}
+	return f.Fake.Down(cfg, iface, log)
+}
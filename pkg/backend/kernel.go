@@ -0,0 +1,104 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/mdlayher/wireguardctrl"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Kernel configures interfaces of the kernel module through netlink
+type Kernel struct{}
+
+var _ Backend = (*Kernel)(nil)
+
+func (k *Kernel) Sync(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	return wgquick.Sync(cfg, iface, log)
+}
+
+func (k *Kernel) Down(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	if _, err := netlink.LinkByName(iface); err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return fmt.Errorf("cannot look up interface %s: %v", iface, err)
+	}
+	return wgquick.Down(cfg, iface, log)
+}
+
+func (k *Kernel) Device(iface string) (*wgtypes.Device, error) {
+	wg, err := wireguardctrl.New()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open wireguard control client: %v", err)
+	}
+	defer wg.Close()
+	return wg.Device(iface)
+}
+
+func (k *Kernel) ConfigureDevice(iface string, cfg wgtypes.Config) error {
+	wg, err := wireguardctrl.New()
+	if err != nil {
+		return fmt.Errorf("cannot open wireguard control client: %v", err)
+	}
+	defer wg.Close()
+	return wg.ConfigureDevice(iface, cfg)
+}
+
+func (k *Kernel) Link(iface string, table, protocol int) (*Link, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil, &os.PathError{Op: "link", Path: iface, Err: os.ErrNotExist}
+		}
+		return nil, fmt.Errorf("cannot look up interface %s: %v", iface, err)
+	}
+
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list addresses: %v", err)
+	}
+	l := &Link{}
+	for _, a := range addrs {
+		// the kernel's own link local addresses
+		if a.Scope == unix.RT_SCOPE_LINK {
+			continue
+		}
+		l.Addresses = append(l.Addresses, *a.IPNet)
+	}
+
+	if table == 0 {
+		table = unix.RT_TABLE_MAIN
+	}
+	routes, err := netlink.RouteListFiltered(netlink.FAMILY_ALL, &netlink.Route{LinkIndex: link.Attrs().Index, Table: table},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list routes: %v", err)
+	}
+	l.Routes = routesOf(routes, protocol)
+	return l, nil
+}
+
+func (k *Kernel) ConfiguresHost() bool {
+	return true
+}
+
+// routesOf returns the destinations of the routes installed with the protocol
+func routesOf(routes []netlink.Route, protocol int) []net.IPNet {
+	var out []net.IPNet
+	for _, r := range routes {
+		if r.Protocol != protocol || r.Dst == nil {
+			continue
+		}
+		if ones, _ := r.Dst.Mask.Size(); ones == 0 {
+			continue
+		}
+		out = append(out, *r.Dst)
+	}
+	return out
+}
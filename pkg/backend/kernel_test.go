@@ -0,0 +1,27 @@
+package backend
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+)
+
+func Test_routesOf(t *testing.T) {
+	dst := func(c string) *net.IPNet {
+		_, n, _ := net.ParseCIDR(c)
+		return n
+	}
+	routes := []netlink.Route{
+		{Dst: dst("10.0.0.0/24"), Protocol: 121},
+		{Dst: dst("fd00::/64"), Protocol: 121},
+		{Dst: dst("10.1.0.0/16"), Protocol: 2},
+		{Dst: dst("0.0.0.0/0"), Protocol: 121},
+		{Protocol: 121},
+	}
+	want := []net.IPNet{*dst("10.0.0.0/24"), *dst("fd00::/64")}
+	if got := routesOf(routes, 121); !reflect.DeepEqual(got, want) {
+		t.Errorf("routesOf() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,64 @@
+package backend
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+)
+
+// WireguardGoPath is the wireguard-go executable the backend runs. The image ships it
+var WireguardGoPath = "wireguard-go"
+
+// WireguardGo runs the wireguard-go executable on a TUN device for interfaces, on hosts without the kernel
+// module. Once it's running, the interface is configured like a kernel one, wireguard-go serves the same
+// configuration protocol and removing the TUN device stops it.
+//
+// wireguard-go isn't embedded in the agent: its device and tun packages require newer golang.org/x/crypto, net
+// and sys than Gopkg.lock pins for the operator's other dependencies, so the image builds it separately, pinned
+// to a module checksum, and the backend runs it for each interface instead
+type WireguardGo struct {
+	Kernel
+	path string
+}
+
+var _ Backend = (*WireguardGo)(nil)
+
+// NewWireguardGo looks up WireguardGoPath, so a missing executable fails the agent on start rather than its
+// first sync
+func NewWireguardGo() (*WireguardGo, error) {
+	path, err := exec.LookPath(WireguardGoPath)
+	if err != nil {
+		return nil, fmt.Errorf("%s backend needs the %s executable: %v", WireguardGoName, WireguardGoPath, err)
+	}
+	return &WireguardGo{path: path}, nil
+}
+
+func (u *WireguardGo) Sync(cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+	if _, err := netlink.LinkByName(iface); err != nil {
+		if _, ok := err.(netlink.LinkNotFoundError); !ok {
+			return fmt.Errorf("cannot look up interface %s: %v", iface, err)
+		}
+		if err := startWireguardGo(u.path, iface, log); err != nil {
+			return err
+		}
+	}
+	return u.Kernel.Sync(cfg, iface, log)
+}
+
+// startWireguardGo creates the TUN device. wireguard-go daemonizes once the device is up
+func startWireguardGo(path, iface string, log logrus.FieldLogger) error {
+	cmd := exec.Command(path, iface)
+	// on Linux it refuses to run without being told the kernel module isn't an option
+	cmd.Env = append(os.Environ(), "WG_I_PREFER_BUGGY_USERSPACE_TO_POLISHED_KMOD=1")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("cannot start %s: %v: %s", path, err, bytes.TrimSpace(out))
+	}
+	log.WithField("iface", iface).Infoln("started wireguard-go")
+	return nil
+}
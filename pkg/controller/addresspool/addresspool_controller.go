@@ -0,0 +1,234 @@
+package addresspool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/ipam"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+type Config struct {
+	Namespace string
+}
+
+// poolController allocates addresses for nodes without any which reference an AddressPool, directly or through their network.
+// Allocations are written into the node's spec, which makes them durable and releases them once the node is deleted.
+type poolController struct {
+	Config
+	client client.Client
+}
+
+var _ reconcile.Reconciler = (*poolController)(nil)
+
+func kindOf(n wgv1alpha1.VPNNode) string {
+	switch n.(type) {
+	case *wgv1alpha1.Server:
+		return "Server"
+	case *wgv1alpha1.Client:
+		return "Client"
+	default:
+		return fmt.Sprintf("%T", n)
+	}
+}
+
+// listNodes returns all servers and clients, oldest first so earlier nodes win allocation races
+func (r *poolController) listNodes(ctx context.Context) ([]wgv1alpha1.VPNNode, error) {
+	servers := &wgv1alpha1.ServerList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, servers); err != nil {
+		return nil, fmt.Errorf("cannot list servers: %v", err)
+	}
+	clients := &wgv1alpha1.ClientList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, clients); err != nil {
+		return nil, fmt.Errorf("cannot list clients: %v", err)
+	}
+	var nodes []wgv1alpha1.VPNNode
+	for i := range servers.Items {
+		nodes = append(nodes, &servers.Items[i])
+	}
+	for i := range clients.Items {
+		nodes = append(nodes, &clients.Items[i])
+	}
+	sort.SliceStable(nodes, func(i, j int) bool {
+		ti, tj := nodes[i].GetCreationTimestamp(), nodes[j].GetCreationTimestamp()
+		if !ti.Equal(&tj) {
+			return ti.Before(&tj)
+		}
+		return nodes[i].GetName() < nodes[j].GetName()
+	})
+	return nodes, nil
+}
+
+// networkPools returns address pools of networks by network name
+func (r *poolController) networkPools(ctx context.Context) (map[string]string, error) {
+	networks := &wgv1alpha1.NetworkList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, networks); err != nil {
+		return nil, fmt.Errorf("cannot list networks: %v", err)
+	}
+	pools := make(map[string]string, len(networks.Items))
+	for _, n := range networks.Items {
+		pools[n.Name] = n.Spec.AddressPool
+	}
+	return pools, nil
+}
+
+// poolOf returns the pool the node's addresses are allocated from, the network's one unless it sets its own
+func poolOf(n wgv1alpha1.VPNNode, networkPools map[string]string) string {
+	if spec := n.GetCommonSpec(); spec.AddressPool != "" {
+		return spec.AddressPool
+	}
+	return networkPools[n.GetCommonSpec().Network]
+}
+
+func addressIP(addr string) net.IP {
+	return net.ParseIP(strings.SplitN(addr, "/", 2)[0])
+}
+
+func (r *poolController) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := logrus.WithField("pool", request.Name)
+
+	pool := &wgv1alpha1.AddressPool{}
+	if err := r.client.Get(ctx, request.NamespacedName, pool); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	p, err := ipam.NewPool(pool.Spec)
+	if err != nil {
+		// retrying won't help until the pool is fixed, which triggers another reconcile
+		log.WithError(err).Errorln("invalid address pool")
+		return reconcile.Result{}, nil
+	}
+
+	nodes, err := r.listNodes(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	networkPools, err := r.networkPools(ctx)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	var (
+		allocations []wgv1alpha1.AddressAllocation
+		pending     []wgv1alpha1.VPNNode
+	)
+	for _, n := range nodes {
+		spec := n.GetCommonSpec()
+		if len(spec.Addresses) == 0 {
+			if poolOf(n, networkPools) == pool.Name {
+				pending = append(pending, n)
+			}
+			continue
+		}
+		// statically addressed nodes occupy pool addresses too, regardless of the pool they reference
+		for _, a := range spec.Addresses {
+			ip := addressIP(a)
+			if ip == nil || !p.Contains(ip) {
+				continue
+			}
+			if !p.Use(ip) {
+				log.WithField("node", n.GetName()).WithField("address", a).Warnln("address is assigned to multiple nodes")
+				continue
+			}
+			allocations = append(allocations, wgv1alpha1.AddressAllocation{Address: a, Kind: kindOf(n), Name: n.GetName()})
+		}
+	}
+
+	for _, n := range pending {
+		nlog := log.WithField("node", n.GetName())
+		var addrs []string
+		for _, f := range p.Families() {
+			a, err := p.Allocate(f)
+			if err != nil {
+				nlog.WithError(err).Errorln("cannot allocate address")
+				continue
+			}
+			addrs = append(addrs, a)
+		}
+		if len(addrs) == 0 {
+			continue
+		}
+		n.GetCommonSpec().Addresses = addrs
+		// route the new addresses to the node, the same as the defaulting webhook does for static ones
+		n.Default()
+		if err := r.client.Update(ctx, n); err != nil {
+			return reconcile.Result{}, fmt.Errorf("cannot assign addresses to %s: %v", n.GetName(), err)
+		}
+		nlog.WithField("addresses", addrs).Infoln("allocated addresses")
+		for _, a := range addrs {
+			allocations = append(allocations, wgv1alpha1.AddressAllocation{Address: a, Kind: kindOf(n), Name: n.GetName()})
+		}
+	}
+
+	pool.Status.Families, pool.Status.Utilization = p.Usage()
+	pool.Status.Allocations = allocations
+	pool.Status.Allocated = len(allocations)
+	if err := r.client.Status().Update(ctx, pool); err != nil {
+		return reconcile.Result{}, fmt.Errorf("cannot update pool status: %v", err)
+	}
+	return reconcile.Result{}, nil
+}
+
+// Add creates a new address pool controller and adds it to the Manager
+func Add(mgr manager.Manager, config Config) error {
+	r := &poolController{
+		Config: config,
+		client: mgr.GetClient(),
+	}
+
+	c, err := controller.New("addresspool-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// allocations only depend on specs. Status updates, the pools' own and the peer state agents keep reporting
+	// into their nodes, leave the generation alone
+	specChanged := predicate.Funcs{
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return ev.MetaOld.GetGeneration() != ev.MetaNew.GetGeneration()
+		},
+	}
+
+	if err := c.Watch(&source.Kind{Type: &wgv1alpha1.AddressPool{}}, &handler.EnqueueRequestForObject{}, specChanged); err != nil {
+		return err
+	}
+
+	// any node or network change may allocate, release or collide with pool addresses
+	allPools := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+			pools := &wgv1alpha1.AddressPoolList{}
+			if err := r.client.List(context.Background(), &client.ListOptions{Namespace: config.Namespace}, pools); err != nil {
+				logrus.WithError(err).Errorln("cannot list address pools")
+				return nil
+			}
+			reqs := make([]reconcile.Request, 0, len(pools.Items))
+			for _, pool := range pools.Items {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: pool.Namespace, Name: pool.Name}})
+			}
+			return reqs
+		}),
+	}
+	if err := c.Watch(&source.Kind{Type: &wgv1alpha1.Client{}}, allPools, specChanged); err != nil {
+		return err
+	}
+	if err := c.Watch(&source.Kind{Type: &wgv1alpha1.Network{}}, allPools, specChanged); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &wgv1alpha1.Server{}}, allPools, specChanged)
+}
@@ -0,0 +1,101 @@
+package finalizer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+type Config struct {
+	Namespace string
+	// Timeout after which a deleted node's interface finalizer is removed although its agent didn't, 0 never does
+	Timeout time.Duration
+}
+
+// finalizerController lets deleted servers or clients go whose agents never come back to take their interfaces
+// down, e.g. lost laptops. The agents remove what's left of the interfaces once they do come back, the CR being
+// gone, as stale interfaces
+type finalizerController struct {
+	Config
+	client  client.Client
+	kind    string
+	newNode func() wgv1alpha1.VPNNode
+	now     func() time.Time
+}
+
+var _ reconcile.Reconciler = (*finalizerController)(nil)
+
+func (r *finalizerController) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := logrus.WithField(r.kind, request.Name)
+
+	node := r.newNode()
+	if err := r.client.Get(ctx, request.NamespacedName, node); err != nil {
+		if apierrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	deleted := node.GetDeletionTimestamp()
+	if deleted == nil {
+		return reconcile.Result{}, nil
+	}
+	finalizers := node.GetFinalizers()
+	kept := make([]string, 0, len(finalizers))
+	for _, f := range finalizers {
+		if f != wgv1alpha1.InterfaceFinalizer {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == len(finalizers) {
+		return reconcile.Result{}, nil
+	}
+	if wait := deleted.Add(r.Timeout).Sub(r.now()); wait > 0 {
+		return reconcile.Result{RequeueAfter: wait}, nil
+	}
+
+	node.SetFinalizers(kept)
+	if err := r.client.Update(ctx, node); err != nil {
+		return reconcile.Result{}, fmt.Errorf("cannot remove finalizer: %v", err)
+	}
+	log.WithField("deleted_at", deleted.Time.Format(time.RFC3339)).Warnln("agent didn't take the interfaces down in time, removed finalizer")
+	return reconcile.Result{}, nil
+}
+
+// Add creates a finalizer controller for servers and one for clients and adds them to the Manager. Nothing is
+// added unless the timeout is set
+func Add(mgr manager.Manager, config Config) error {
+	if config.Timeout <= 0 {
+		return nil
+	}
+	for kind, newNode := range map[string]func() wgv1alpha1.VPNNode{
+		"server": func() wgv1alpha1.VPNNode { return &wgv1alpha1.Server{} },
+		"client": func() wgv1alpha1.VPNNode { return &wgv1alpha1.Client{} },
+	} {
+		r := &finalizerController{
+			Config:  config,
+			client:  mgr.GetClient(),
+			kind:    kind,
+			newNode: newNode,
+			now:     time.Now,
+		}
+		c, err := controller.New(kind+"-finalizer-controller", mgr, controller.Options{Reconciler: r})
+		if err != nil {
+			return err
+		}
+		if err := c.Watch(&source.Kind{Type: newNode()}, &handler.EnqueueRequestForObject{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
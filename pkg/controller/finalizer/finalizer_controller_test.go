@@ -0,0 +1,60 @@
+package finalizer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/apis"
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcile(t *testing.T) {
+	if err := apis.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	deleted := metav1.NewTime(time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC))
+	laptop := &wgv1alpha1.Client{ObjectMeta: metav1.ObjectMeta{
+		Name:              "laptop",
+		Namespace:         "wg",
+		DeletionTimestamp: &deleted,
+		Finalizers:        []string{"other", wgv1alpha1.InterfaceFinalizer},
+	}}
+	now := deleted.Add(30 * time.Minute)
+	r := &finalizerController{
+		Config:  Config{Namespace: "wg", Timeout: time.Hour},
+		client:  fake.NewFakeClient(laptop),
+		kind:    "client",
+		newNode: func() wgv1alpha1.VPNNode { return &wgv1alpha1.Client{} },
+		now:     func() time.Time { return now },
+	}
+	key := client.ObjectKey{Namespace: "wg", Name: "laptop"}
+	got := &wgv1alpha1.Client{}
+
+	res, err := r.Reconcile(reconcile.Request{NamespacedName: key})
+	if err != nil || res.RequeueAfter != 30*time.Minute {
+		t.Fatalf("Reconcile() before the timeout = %+v, %v, want a requeue after 30m", res, err)
+	}
+	if err := r.client.Get(context.Background(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 2 {
+		t.Errorf("finalizers before the timeout = %v, want both kept", got.Finalizers)
+	}
+
+	now = deleted.Add(time.Hour)
+	if res, err := r.Reconcile(reconcile.Request{NamespacedName: key}); err != nil || res.RequeueAfter != 0 {
+		t.Fatalf("Reconcile() after the timeout = %+v, %v", res, err)
+	}
+	if err := r.client.Get(context.Background(), key, got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Finalizers) != 1 || got.Finalizers[0] != "other" {
+		t.Errorf("finalizers after the timeout = %v, want only other", got.Finalizers)
+	}
+}
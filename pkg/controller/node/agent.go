@@ -0,0 +1,350 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/firewall"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// agent runs a nodeController for each interface it manages. Each one syncs and backs off on its own,
+// so a broken interface doesn't hold back the others
+type agent struct {
+	NodeControllerConfig
+	client client.Client
+	scheme *runtime.Scheme
+	update chan bool
+	// nodes are cluster scoped, so they're watched outside of the manager's namespaced cache. Nil unless
+	// some interface may be a server
+	nodes cache.SharedIndexInformer
+	// records events on the workers' CRs
+	recorder record.EventRecorder
+
+	mu      sync.Mutex
+	workers map[string]*worker
+
+	// heartbeat of the loop, served on the health endpoints
+	health healthState
+}
+
+type worker struct {
+	InterfaceConfig
+	ctl  *nodeController
+	stop chan struct{}
+	done chan struct{}
+}
+
+var _ manager.Runnable = (*agent)(nil)
+var _ reconcile.Reconciler = (*agent)(nil)
+
+func (a *agent) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	logrus.WithField("name", request.Name).WithField("namespace", request.Namespace).Infoln("update triggered")
+	// a pending update already refreshes the workers
+	select {
+	case a.update <- true:
+	default:
+	}
+	return reconcile.Result{}, nil
+}
+
+func (a *agent) Start(done <-chan struct{}) error {
+	log := logrus.WithField("node", a.NodeName)
+	if a.nodes != nil {
+		go a.nodes.Run(done)
+	}
+	state := make(map[string]bool)
+	if a.StateFile != "" {
+		var err error
+		if state, err = readState(a.StateFile); err != nil {
+			log.WithError(err).Warnln("cannot read interface state, interfaces created before won't be removed")
+			state = make(map[string]bool)
+		}
+	}
+
+	resync := time.NewTicker(a.StatusInterval)
+	defer resync.Stop()
+	refresh := func() {
+		a.reconcileWorkers(log)
+		a.removeStale(state, log)
+	}
+	refresh()
+	for {
+		a.health.beat(time.Now())
+		select {
+		case <-done:
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			for _, w := range a.workers {
+				w.halt()
+			}
+			return nil
+		case <-resync.C:
+			refresh()
+		case <-a.update:
+			refresh()
+			a.mu.Lock()
+			for _, w := range a.workers {
+				// a pending update already triggers a sync
+				select {
+				case w.ctl.update <- true:
+				default:
+				}
+			}
+			a.mu.Unlock()
+		}
+	}
+}
+
+// mine reports whether the object is one of my CRs, named after me or labelled with my name
+func (a *agent) mine(obj runtime.Object) bool {
+	m, ok := obj.(metav1.Object)
+	if !ok {
+		return false
+	}
+	return m.GetName() == a.NodeName || m.GetLabels()[wgv1alpha1.NodeLabel] == a.NodeName
+}
+
+// desiredInterfaces returns the interfaces from the interfaces file, or otherwise one for each of my CRs
+// on its network's interface. In auto mode both my servers and clients are configured
+func (a *agent) desiredInterfaces(ctx context.Context, log logrus.FieldLogger) ([]InterfaceConfig, error) {
+	if len(a.Interfaces) > 0 {
+		return a.Interfaces, nil
+	}
+
+	var nodes []wgv1alpha1.VPNNode
+	opts := &client.ListOptions{Namespace: a.Namespace}
+	if a.Mode == Server || a.Mode == Auto {
+		list := &wgv1alpha1.ServerList{}
+		if err := a.client.List(ctx, opts, list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			nodes = append(nodes, &list.Items[i])
+		}
+	}
+	if a.Mode == Client || a.Mode == Auto {
+		list := &wgv1alpha1.ClientList{}
+		if err := a.client.List(ctx, opts, list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			nodes = append(nodes, &list.Items[i])
+		}
+	}
+	// the CR named after me keeps the agent's interface in case of conflicts, a server before a client
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if (nodes[i].NodeName() == a.NodeName) != (nodes[j].NodeName() == a.NodeName) {
+			return nodes[i].NodeName() == a.NodeName
+		}
+		return nodes[i].NodeName() < nodes[j].NodeName()
+	})
+
+	var ifaces []InterfaceConfig
+	taken := make(map[string]string)
+	for _, n := range nodes {
+		if !a.mine(n) {
+			continue
+		}
+		iface := a.Interface
+		network, err := fetchNetwork(ctx, a.client, a.Namespace, n)
+		if err != nil {
+			// the worker reports the missing network in the node's status
+			log.WithError(err).WithField("node", n.NodeName()).Warnln("cannot resolve network interface")
+		} else if network != nil && network.Spec.Interface != "" {
+			iface = network.Spec.Interface
+		}
+		mode, kind := Server, "server"
+		if _, ok := n.(*wgv1alpha1.Client); ok {
+			mode, kind = Client, "client"
+		}
+		if other, ok := taken[iface]; ok {
+			log.WithField(kind, n.NodeName()).Errorf("interface %s is already configured from %s, set a distinct interface on the network", iface, other)
+			continue
+		}
+		taken[iface] = kind + " " + n.NodeName()
+		ic := defaultInterface(a.NodeControllerConfig, iface, n.NodeName())
+		ic.Mode = mode
+		ifaces = append(ifaces, ic)
+	}
+	return ifaces, nil
+}
+
+// reconcileWorkers starts a worker for each new interface, and stops the ones which are gone or changed
+func (a *agent) reconcileWorkers(log logrus.FieldLogger) {
+	ifaces, err := a.desiredInterfaces(context.Background(), log)
+	if err != nil {
+		log.WithError(err).Errorln("cannot determine interfaces to manage")
+		return
+	}
+	desired := make(map[string]InterfaceConfig, len(ifaces))
+	for _, ic := range ifaces {
+		desired[ic.Name] = ic
+	}
+
+	a.mu.Lock()
+	var stopped []*worker
+	for name, w := range a.workers {
+		if ic, ok := desired[name]; !ok || ic != w.InterfaceConfig {
+			log.WithField("iface", name).Infoln("stopping interface worker")
+			stopped = append(stopped, w)
+			delete(a.workers, name)
+		}
+	}
+	a.mu.Unlock()
+	// a replacement must not start before the old worker is done with the interface
+	for _, w := range stopped {
+		w.halt()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for name, ic := range desired {
+		if _, ok := a.workers[name]; ok {
+			continue
+		}
+		log.WithField("iface", name).WithField("name", ic.NodeName).Infoln("starting interface worker")
+		w := a.newWorker(ic)
+		a.workers[name] = w
+		go func() {
+			defer close(w.done)
+			w.ctl.Start(w.stop)
+		}()
+	}
+}
+
+func (a *agent) newWorker(ic InterfaceConfig) *worker {
+	config := a.NodeControllerConfig
+	config.Interface = ic.Name
+	config.NodeName = ic.NodeName
+	config.Mode = ic.Mode
+	config.PrivateKeyFile = ic.PrivateKeyFile
+	config.RouteTable = ic.RouteTable
+	config.RouteMetric = ic.RouteMetric
+	config.Interfaces = nil
+	return &worker{
+		InterfaceConfig: ic,
+		ctl: &nodeController{
+			client:               a.client,
+			scheme:               a.scheme,
+			update:               make(chan bool, 1),
+			resolver:             newEndpointResolver(config.EndpointMaxTTL, config.PreferIPv6Endpoints),
+			nodes:                a.nodeStore(),
+			events:               newEventEmitter(a.recorder),
+			firewallInstalled:    true,
+			NodeControllerConfig: config,
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (a *agent) nodeStore() cache.Store {
+	if a.nodes == nil {
+		return nil
+	}
+	return a.nodes.GetStore()
+}
+
+// halt stops the worker and waits for its sync in progress to finish
+func (w *worker) halt() {
+	close(w.stop)
+	<-w.done
+}
+
+// controllers returns the running workers' controllers
+func (a *agent) controllers() []*nodeController {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ctls := make([]*nodeController, 0, len(a.workers))
+	for _, w := range a.workers {
+		ctls = append(ctls, w.ctl)
+	}
+	return ctls
+}
+
+// removeStale tears down interfaces recorded in the state as created by me which no worker manages anymore,
+// and records the interfaces the workers configured since. Until a worker synced successfully, the interfaces
+// it configures besides its own, e.g. split ones after a restart, aren't known, so the ones it could own are
+// kept until then
+func (a *agent) removeStale(state map[string]bool, log logrus.FieldLogger) {
+	if a.DryRun || a.StateFile == "" {
+		return
+	}
+	owned := make(map[string]bool)
+	var unsynced []string
+	for _, ctl := range a.controllers() {
+		owned[ctl.Interface] = true
+		for _, iface := range ctl.appliedInterfaces() {
+			owned[iface] = true
+		}
+		if !ctl.health.everSucceeded() {
+			unsynced = append(unsynced, ctl.Interface)
+		}
+	}
+
+	changed := false
+	for iface := range state {
+		if owned[iface] || mayOwn(unsynced, iface) {
+			continue
+		}
+		log := log.WithField("iface", iface)
+		if err := a.Backend.Down(&wgquick.Config{}, iface, log); err != nil {
+			log.WithError(err).Warnln("cannot remove stale interface")
+			continue
+		}
+		if err := firewall.Remove(iface); err != nil {
+			log.WithError(err).Warnln("cannot remove firewall rules of stale interface")
+			continue
+		}
+		log.Infoln("removed stale interface")
+		forgetInterface(iface)
+		delete(state, iface)
+		changed = true
+	}
+	for iface := range owned {
+		if !state[iface] && a.applied(iface) {
+			state[iface] = true
+			changed = true
+		}
+	}
+	if changed {
+		if err := writeState(a.StateFile, state); err != nil {
+			log.WithError(err).Warnln("cannot write interface state")
+		}
+	}
+}
+
+// mayOwn reports whether the interface is one of the interfaces or split from one of them
+func mayOwn(interfaces []string, iface string) bool {
+	for _, i := range interfaces {
+		if iface == i || strings.HasPrefix(iface, i+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+// applied reports whether any worker configured the interface in its last successful sync
+func (a *agent) applied(iface string) bool {
+	for _, ctl := range a.controllers() {
+		for _, i := range ctl.appliedInterfaces() {
+			if i == iface {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package node
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// TestAgent_removeStale checks a restarted agent keeps the split interfaces of its state until the worker
+// configuring them synced
+func TestAgent_removeStale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := backend.NewFake()
+	log := logrus.New()
+	for _, iface := range []string{"wg0-gateway", "wg0-old"} {
+		if err := b.Sync(&wgquick.Config{}, iface, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := &agent{
+		NodeControllerConfig: NodeControllerConfig{StateFile: path.Join(dir, "interfaces"), Backend: b},
+		workers:              map[string]*worker{"wg0": {ctl: &nodeController{NodeControllerConfig: NodeControllerConfig{Interface: "wg0"}}}},
+	}
+	state := map[string]bool{"wg0-gateway": true, "wg0-old": true}
+
+	a.removeStale(state, log)
+	if got, want := b.Interfaces(), []string{"wg0-gateway", "wg0-old"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("interfaces before the worker synced = %v, want %v", got, want)
+	}
+
+	ctl := a.workers["wg0"].ctl
+	ctl.interfaces = []string{"wg0-gateway"}
+	ctl.health.synced(time.Now(), nil)
+	a.removeStale(state, log)
+	if got, want := b.Interfaces(), []string{"wg0-gateway"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("interfaces after the worker synced = %v, want %v", got, want)
+	}
+}
+
+// TestAgent_removeStale_failing checks a worker which never synced only holds back the interfaces it could own
+func TestAgent_removeStale_failing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := backend.NewFake()
+	log := logrus.New()
+	stale := []string{"wg0-gateway", "wg1", "wg1-old", "wg2"}
+	for _, iface := range stale {
+		if err := b.Sync(&wgquick.Config{}, iface, log); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failing := &nodeController{NodeControllerConfig: NodeControllerConfig{Interface: "wg0"}}
+	failing.health.synced(time.Now(), errors.New("network not found"))
+	healthy := &nodeController{NodeControllerConfig: NodeControllerConfig{Interface: "wg1"}}
+	healthy.interfaces = []string{"wg1"}
+	healthy.health.synced(time.Now(), nil)
+	a := &agent{
+		NodeControllerConfig: NodeControllerConfig{StateFile: path.Join(dir, "interfaces"), Backend: b},
+		workers:              map[string]*worker{"wg0": {ctl: failing}, "wg1": {ctl: healthy}},
+	}
+	state := make(map[string]bool)
+	for _, iface := range stale {
+		state[iface] = true
+	}
+
+	a.removeStale(state, log)
+	if got, want := b.Interfaces(), []string{"wg0-gateway", "wg1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("interfaces = %v, want %v", got, want)
+	}
+}
+
+func TestAgent_Reconcile(t *testing.T) {
+	a := &agent{update: make(chan bool, 1)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			a.Reconcile(reconcile.Request{})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Reconcile() blocked on a pending update")
+	}
+	if len(a.update) != 1 {
+		t.Errorf("pending updates = %d, want 1", len(a.update))
+	}
+}
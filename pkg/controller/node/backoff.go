@@ -0,0 +1,51 @@
+package node
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff computes capped exponential retry delays with jitter so many agents failing at once
+// don't hammer the apiserver in lockstep
+type backoff struct {
+	Base     time.Duration
+	Max      time.Duration
+	failures int
+	rand     *rand.Rand
+}
+
+func newBackoff(base, max time.Duration) *backoff {
+	return &backoff{
+		Base: base,
+		Max:  max,
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Next records a failure and returns how long to wait before the next attempt.
+// The delay is uniformly distributed in [d/2, d) where d = min(Max, Base * 2^(failures-1))
+func (b *backoff) Next() time.Duration {
+	d := b.Base
+	for i := 0; i < b.failures && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	b.failures++
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(b.rand.Int63n(int64(half)))
+}
+
+// Reset clears the failure count after a successful attempt
+func (b *backoff) Reset() {
+	b.failures = 0
+}
+
+// Failures returns the number of consecutive failures
+func (b *backoff) Failures() int {
+	return b.failures
+}
@@ -0,0 +1,44 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_backoff_Next(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		wantMin  time.Duration
+		wantMax  time.Duration
+	}{
+		{"first failure", 0, 500 * time.Millisecond, time.Second},
+		{"second failure", 1, time.Second, 2 * time.Second},
+		{"fourth failure", 3, 4 * time.Second, 8 * time.Second},
+		{"capped", 10, 5 * time.Second, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBackoff(time.Second, 10*time.Second)
+			b.failures = tt.failures
+			got := b.Next()
+			if got < tt.wantMin || got >= tt.wantMax {
+				t.Errorf("backoff.Next() = %v, want in [%v, %v)", got, tt.wantMin, tt.wantMax)
+			}
+			if b.Failures() != tt.failures+1 {
+				t.Errorf("backoff.Failures() = %v, want %v", b.Failures(), tt.failures+1)
+			}
+		})
+	}
+}
+
+func Test_backoff_Reset(t *testing.T) {
+	b := newBackoff(time.Second, time.Minute)
+	for i := 0; i < 5; i++ {
+		b.Next()
+	}
+	b.Reset()
+	if got := b.Next(); got >= time.Second {
+		t.Errorf("backoff.Next() after Reset = %v, want < %v", got, time.Second)
+	}
+}
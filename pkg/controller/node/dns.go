@@ -0,0 +1,212 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	resolvConf = "/etc/resolv.conf"
+	// queryTimeout limits a single query to a nameserver
+	queryTimeout = 2 * time.Second
+)
+
+// lookupHost resolves the host's addresses along with how long they may be cached. The system resolver doesn't
+// expose TTLs, so the nameservers from resolv.conf are asked directly. Names they don't answer, e.g. ones from
+// /etc/hosts or search domains, are left to the system resolver and cached for fallbackTTL
+func lookupHost(ctx context.Context, host string, fallbackTTL time.Duration) ([]net.IP, time.Duration, error) {
+	if ips, ttl, err := queryNameservers(ctx, host); err == nil && len(ips) > 0 {
+		return ips, ttl, nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, fallbackTTL, nil
+}
+
+func nameservers() ([]string, error) {
+	b, err := ioutil.ReadFile(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	var servers []string
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, net.JoinHostPort(fields[1], "53"))
+		}
+	}
+	return servers, nil
+}
+
+// queryNameservers asks the first nameserver which answers for the host's A and AAAA records, each query
+// limited to queryTimeout so an unresponsive nameserver leaves time for the next one.
+// The returned TTL is the shortest one among the records
+func queryNameservers(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	servers, err := nameservers()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !strings.HasSuffix(host, ".") {
+		host += "."
+	}
+	name, err := dnsmessage.NewName(host)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	lastErr := errors.New("no nameservers configured")
+outer:
+	for _, server := range servers {
+		var ips []net.IP
+		var ttl uint32 = math.MaxUint32
+		for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			qctx, cancel := context.WithTimeout(ctx, queryTimeout)
+			records, err := query(qctx, server, name, qtype)
+			cancel()
+			if err != nil {
+				lastErr = err
+				continue outer
+			}
+			for _, rec := range records {
+				ips = append(ips, rec.ip)
+				if rec.ttl < ttl {
+					ttl = rec.ttl
+				}
+			}
+		}
+		return ips, time.Duration(ttl) * time.Second, nil
+	}
+	return nil, 0, lastErr
+}
+
+type record struct {
+	ip  net.IP
+	ttl uint32
+}
+
+// query asks a single question over UDP, and over TCP if the answer doesn't fit. A name which doesn't exist
+// has no records
+func query(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) ([]record, error) {
+	q := dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET}
+	req := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{q},
+	}
+	packed, err := req.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := exchangeUDP(ctx, server, packed, req.ID, q)
+	if err == nil && resp.Truncated {
+		resp, err = exchangeTCP(ctx, server, packed, req.ID, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.RCode == dnsmessage.RCodeNameError:
+		return nil, nil
+	case resp.RCode != dnsmessage.RCodeSuccess:
+		return nil, fmt.Errorf("%s answered %v", server, resp.RCode)
+	}
+
+	var records []record
+	for _, a := range resp.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			records = append(records, record{ip: net.IP(body.A[:]), ttl: a.Header.TTL})
+		case *dnsmessage.AAAAResource:
+			records = append(records, record{ip: net.IP(body.AAAA[:]), ttl: a.Header.TTL})
+		}
+	}
+	return records, nil
+}
+
+// answers reports whether the response belongs to the request with the id and question
+func answers(resp *dnsmessage.Message, id uint16, q dnsmessage.Question) bool {
+	return resp.ID == id && resp.Response && len(resp.Questions) == 1 &&
+		resp.Questions[0].Type == q.Type && resp.Questions[0].Class == q.Class &&
+		strings.EqualFold(resp.Questions[0].Name.String(), q.Name.String())
+}
+
+func dial(ctx context.Context, network, server string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return conn, nil
+}
+
+// exchangeUDP sends the request and waits for its response. Datagrams which don't answer it, e.g. late
+// responses to earlier queries or spoofing attempts, are skipped
+func exchangeUDP(ctx context.Context, server string, packed []byte, id uint16, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	conn, err := dial(ctx, "udp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 512)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		var resp dnsmessage.Message
+		if err := resp.Unpack(buf[:n]); err != nil || !answers(&resp, id, q) {
+			continue
+		}
+		return &resp, nil
+	}
+}
+
+// exchangeTCP sends the request over TCP, each message prefixed with its length
+func exchangeTCP(ctx context.Context, server string, packed []byte, id uint16, q dnsmessage.Question) (*dnsmessage.Message, error) {
+	conn, err := dial(ctx, "tcp", server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write(append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...)); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, int(length[0])<<8|int(length[1]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf); err != nil {
+		return nil, err
+	}
+	if !answers(&resp, id, q) {
+		return nil, fmt.Errorf("%s answered another query", server)
+	}
+	return &resp, nil
+}
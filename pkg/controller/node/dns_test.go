@@ -0,0 +1,112 @@
+package node
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// listenDNS serves the same port over UDP and TCP. UDP answers with a stray datagram first and then the real
+// response truncated, so only TCP gets the answer through
+func listenDNS(t *testing.T, answer dnsmessage.Resource) (string, func()) {
+	var tcp net.Listener
+	var udp net.PacketConn
+	for i := 0; ; i++ {
+		var err error
+		if tcp, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if udp, err = net.ListenPacket("udp", tcp.Addr().String()); err == nil {
+			break
+		}
+		tcp.Close()
+		if i == 10 {
+			t.Fatal(err)
+		}
+	}
+
+	respond := func(req []byte, id uint16, truncated bool) []byte {
+		var m dnsmessage.Message
+		if err := m.Unpack(req); err != nil {
+			return nil
+		}
+		m.ID, m.Response, m.Truncated = id, true, truncated
+		if !truncated {
+			m.Answers = []dnsmessage.Resource{answer}
+		}
+		b, _ := m.Pack()
+		return b
+	}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			id := binary.BigEndian.Uint16(buf)
+			udp.WriteTo(respond(buf[:n], id+1, false), addr)
+			udp.WriteTo(respond(buf[:n], id, true), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err == nil {
+				req := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, req); err == nil {
+					resp := respond(req, binary.BigEndian.Uint16(req), false)
+					conn.Write(append([]byte{byte(len(resp) >> 8), byte(len(resp))}, resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return tcp.Addr().String(), func() {
+		tcp.Close()
+		udp.Close()
+	}
+}
+
+func TestQuery(t *testing.T) {
+	name := dnsmessage.MustNewName("vpn.example.com.")
+	answer := dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 300},
+		Body:   &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}},
+	}
+	server, stop := listenDNS(t, answer)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	records, err := query(ctx, server, name, dnsmessage.TypeA)
+	if err != nil {
+		t.Fatalf("query() error = %v", err)
+	}
+	if len(records) != 1 || !records[0].ip.Equal(net.ParseIP("192.0.2.1")) || records[0].ttl != 300 {
+		t.Errorf("query() = %+v, want 192.0.2.1 for 300s", records)
+	}
+}
+
+func TestQuery_timeout(t *testing.T) {
+	// nothing answers, the query gives up at its deadline
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := query(ctx, udp.LocalAddr().String(), dnsmessage.MustNewName("vpn.example.com."), dnsmessage.TypeA); err == nil {
+		t.Error("query() of a silent nameserver succeeded")
+	}
+}
@@ -0,0 +1,201 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// ReasonDriftDetected is the reason of events reporting an interface deviating from its config
+const ReasonDriftDetected = "DriftDetected"
+
+// drift lists how an interface deviates from the config last applied to it
+type drift struct {
+	iface string
+	// the interface is gone altogether
+	missing    bool
+	privateKey bool
+	listenPort bool
+	// peers the device lacks, has on top and has configured differently
+	peers                            peerChanges
+	missingAddresses, extraAddresses []string
+	missingRoutes, extraRoutes       []string
+}
+
+func (d drift) any() bool {
+	return len(d.kinds()) > 0
+}
+
+// driftKinds are all the kinds of drift
+var driftKinds = []string{"interface", "private_key", "listen_port", "peers", "addresses", "routes"}
+
+// kinds names the parts of the interface that drifted, used as metric labels
+func (d drift) kinds() []string {
+	var kinds []string
+	if d.missing {
+		return []string{"interface"}
+	}
+	if d.privateKey {
+		kinds = append(kinds, "private_key")
+	}
+	if d.listenPort {
+		kinds = append(kinds, "listen_port")
+	}
+	if d.peers.any() {
+		kinds = append(kinds, "peers")
+	}
+	if len(d.missingAddresses)+len(d.extraAddresses) > 0 {
+		kinds = append(kinds, "addresses")
+	}
+	if len(d.missingRoutes)+len(d.extraRoutes) > 0 {
+		kinds = append(kinds, "routes")
+	}
+	return kinds
+}
+
+func (d drift) String() string {
+	if d.missing {
+		return fmt.Sprintf("interface %s is gone", d.iface)
+	}
+	var parts []string
+	if d.privateKey {
+		parts = append(parts, "private key differs")
+	}
+	if d.listenPort {
+		parts = append(parts, "listen port differs")
+	}
+	if d.peers.any() {
+		parts = append(parts, fmt.Sprintf("%d peers missing, %d unexpected, %d changed", d.peers.added, d.peers.removed, d.peers.updated))
+	}
+	list := func(what string, s []string) {
+		if len(s) > 0 {
+			parts = append(parts, what+" "+strings.Join(s, ", "))
+		}
+	}
+	list("missing addresses", d.missingAddresses)
+	list("unexpected addresses", d.extraAddresses)
+	list("missing routes", d.missingRoutes)
+	list("unexpected routes", d.extraRoutes)
+	return fmt.Sprintf("interface %s drifted: %s", d.iface, strings.Join(parts, "; "))
+}
+
+// detectDrift compares the live device, addresses and routes of an interface to the config applied to it
+func detectDrift(b backend.Backend, iface string, cfg *wgquick.Config) (drift, error) {
+	d := drift{iface: iface}
+	dev, err := b.Device(iface)
+	if os.IsNotExist(err) {
+		d.missing = true
+		return d, nil
+	} else if err != nil {
+		return d, fmt.Errorf("cannot read device: %v", err)
+	}
+	d.privateKey = cfg.PrivateKey != nil && dev.PrivateKey != *cfg.PrivateKey
+	d.listenPort = cfg.ListenPort != nil && dev.ListenPort != *cfg.ListenPort
+	// peers roam and endpoints are re-resolved without a sync, so the device's endpoints are never drift
+	peers := make([]wgtypes.PeerConfig, len(cfg.Peers))
+	for i, p := range cfg.Peers {
+		p.Endpoint = nil
+		peers[i] = p
+	}
+	d.peers = diffPeers(dev.Peers, peers)
+
+	link, err := b.Link(iface, cfg.Table, cfg.RouteProtocol)
+	if os.IsNotExist(err) {
+		d.missing = true
+		return d, nil
+	} else if err != nil {
+		return d, err
+	}
+	var haveAddrs, wantAddrs []string
+	for _, a := range link.Addresses {
+		haveAddrs = append(haveAddrs, a.String())
+	}
+	for _, a := range cfg.Address {
+		wantAddrs = append(wantAddrs, a.String())
+	}
+	d.missingAddresses, d.extraAddresses = diffStrings(wantAddrs, haveAddrs)
+
+	var haveRoutes []string
+	for _, r := range link.Routes {
+		haveRoutes = append(haveRoutes, r.String())
+	}
+	d.missingRoutes, d.extraRoutes = diffStrings(wantRoutes(cfg), haveRoutes)
+	return d, nil
+}
+
+// wantRoutes are the routes to the peers' allowed IPs. Default routes are left out, as backends do
+func wantRoutes(cfg *wgquick.Config) []string {
+	var out []string
+	for _, p := range cfg.Peers {
+		for _, n := range p.AllowedIPs {
+			if ones, _ := n.Mask.Size(); ones == 0 {
+				continue
+			}
+			out = append(out, (&net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask}).String())
+		}
+	}
+	return out
+}
+
+// diffStrings returns the sorted, unique elements missing from have and the ones have holds on top
+func diffStrings(want, have []string) (missing, extra []string) {
+	wantSet := make(map[string]bool, len(want))
+	for _, w := range want {
+		wantSet[w] = true
+	}
+	haveSet := make(map[string]bool, len(have))
+	for _, h := range have {
+		haveSet[h] = true
+		if !wantSet[h] {
+			extra = append(extra, h)
+			wantSet[h] = true
+		}
+	}
+	for w := range wantSet {
+		if !haveSet[w] {
+			missing = append(missing, w)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+// checkDrift compares the interfaces to the configs of the last successful sync and reports the drift. It
+// returns whether to correct the drift with a sync
+func (r *nodeController) checkDrift(log logrus.FieldLogger) bool {
+	drifted := false
+	for iface, cfg := range r.applied {
+		cfg := cfg
+		log := log.WithField("iface", iface)
+		d, err := detectDrift(r.Backend, iface, &cfg)
+		if err != nil {
+			log.WithError(err).Warnln("cannot check interface for drift")
+			continue
+		}
+		if !d.any() {
+			driftDetected.WithLabelValues(iface).Set(0)
+			continue
+		}
+		drifted = true
+		driftDetected.WithLabelValues(iface).Set(1)
+		for _, kind := range d.kinds() {
+			driftTotal.WithLabelValues(iface, kind).Inc()
+		}
+		msg := d.String()
+		if r.DriftReportOnly {
+			msg += ", not correcting it"
+		}
+		log.WithField("drift", d.kinds()).Warnln(msg)
+		r.events.emit(r.self, corev1.EventTypeWarning, ReasonDriftDetected, iface, msg)
+	}
+	return drifted && !r.DriftReportOnly
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/tools/record"
+)
+
+func Test_diffStrings(t *testing.T) {
+	tests := []struct {
+		name        string
+		want, have  []string
+		wantMissing []string
+		wantExtra   []string
+	}{
+		{"equal", []string{"a", "b"}, []string{"b", "a"}, nil, nil},
+		{"missing", []string{"a", "b", "c"}, []string{"b"}, []string{"a", "c"}, nil},
+		{"extra", []string{"a"}, []string{"c", "a", "b", "c"}, nil, []string{"b", "c"}},
+		{"both", []string{"a", "a", "b"}, []string{"c"}, []string{"a", "b"}, []string{"c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, extra := diffStrings(tt.want, tt.have)
+			if !reflect.DeepEqual(missing, tt.wantMissing) || !reflect.DeepEqual(extra, tt.wantExtra) {
+				t.Errorf("diffStrings() = %v, %v, want %v, %v", missing, extra, tt.wantMissing, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestDrift_String(t *testing.T) {
+	tests := []struct {
+		name      string
+		d         drift
+		want      string
+		wantKinds []string
+	}{
+		{"none", drift{iface: "wg0"}, "", nil},
+		{"gone", drift{iface: "wg0", missing: true}, "interface wg0 is gone", []string{"interface"}},
+		{"peers and routes", drift{iface: "wg0", peers: peerChanges{removed: 1}, missingRoutes: []string{"10.0.0.0/24"}},
+			"interface wg0 drifted: 0 peers missing, 1 unexpected, 0 changed; missing routes 10.0.0.0/24", []string{"peers", "routes"}},
+		{"key and addresses", drift{iface: "wg0", privateKey: true, extraAddresses: []string{"10.9.0.1/24"}},
+			"interface wg0 drifted: private key differs; unexpected addresses 10.9.0.1/24", []string{"private_key", "addresses"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.d.any() {
+				if got := tt.d.String(); got != tt.want {
+					t.Errorf("String() = %q, want %q", got, tt.want)
+				}
+			}
+			if got := tt.d.kinds(); !reflect.DeepEqual(got, tt.wantKinds) {
+				t.Errorf("kinds() = %v, want %v", got, tt.wantKinds)
+			}
+		})
+	}
+}
+
+// TestCheckDrift changes a synced interface behind the agent's back on the fake backend, and checks the drift is
+// detected, reported, and corrected by a sync unless it's only reported
+func TestCheckDrift(t *testing.T) {
+	_, laptopRoute, _ := net.ParseCIDR("10.0.0.2/32")
+	tests := []struct {
+		name   string
+		mutate func(t *testing.T, b *backend.Fake, laptop wgtypes.Key)
+		want   func(d drift) bool
+	}{
+		{"peer removed", func(t *testing.T, b *backend.Fake, laptop wgtypes.Key) {
+			if err := b.ConfigureDevice("wg0", wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: laptop, Remove: true}}}); err != nil {
+				t.Fatal(err)
+			}
+		}, func(d drift) bool { return d.peers.added == 1 }},
+		{"route deleted", func(t *testing.T, b *backend.Fake, laptop wgtypes.Key) {
+			b.DeleteRoute("wg0", *laptopRoute)
+		}, func(d drift) bool { return reflect.DeepEqual(d.missingRoutes, []string{"10.0.0.2/32"}) }},
+		{"listen port changed", func(t *testing.T, b *backend.Fake, laptop wgtypes.Key) {
+			port := 51821
+			if err := b.ConfigureDevice("wg0", wgtypes.Config{ListenPort: &port}); err != nil {
+				t.Fatal(err)
+			}
+		}, func(d drift) bool { return d.listenPort }},
+		{"interface gone", func(t *testing.T, b *backend.Fake, laptop wgtypes.Key) {
+			if err := b.Down(&wgquick.Config{}, "wg0", logrus.New()); err != nil {
+				t.Fatal(err)
+			}
+		}, func(d drift) bool { return d.missing }},
+	}
+	for _, tt := range tests {
+		for _, reportOnly := range []bool{false, true} {
+			name := tt.name
+			if reportOnly {
+				name += " report only"
+			}
+			t.Run(name, func(t *testing.T) {
+				ctl, b, laptop, cleanup := newTestServer(t)
+				defer cleanup()
+				recorder := record.NewFakeRecorder(10)
+				ctl.events = newEventEmitter(recorder)
+				ctl.DriftReportOnly = reportOnly
+				log := logrus.WithField("iface", "wg0")
+				if err := ctl.sync(); err != nil {
+					t.Fatalf("sync() error = %v", err)
+				}
+				if ctl.checkDrift(log) {
+					t.Fatal("checkDrift() found drift right after a sync")
+				}
+				// the sync's own events
+				for len(recorder.Events) > 0 {
+					<-recorder.Events
+				}
+
+				tt.mutate(t, b, laptop)
+				cfg := ctl.applied["wg0"]
+				d, err := detectDrift(b, "wg0", &cfg)
+				if err != nil {
+					t.Fatalf("detectDrift() error = %v", err)
+				}
+				if !tt.want(d) {
+					t.Errorf("detectDrift() = %+v", d)
+				}
+				if correct := ctl.checkDrift(log); correct == reportOnly {
+					t.Errorf("checkDrift() = %v, want %v", correct, !reportOnly)
+				}
+				select {
+				case ev := <-recorder.Events:
+					if !strings.Contains(ev, ReasonDriftDetected) || strings.Contains(ev, "not correcting") != reportOnly {
+						t.Errorf("event = %q, want %s noting whether it's corrected", ev, ReasonDriftDetected)
+					}
+				default:
+					t.Errorf("no %s event recorded", ReasonDriftDetected)
+				}
+
+				if reportOnly {
+					return
+				}
+				if err := ctl.sync(); err != nil {
+					t.Fatalf("sync() error = %v", err)
+				}
+				if ctl.checkDrift(log) {
+					t.Error("checkDrift() found drift after correcting it")
+				}
+			})
+		}
+	}
+}
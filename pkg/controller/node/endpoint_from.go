@@ -0,0 +1,134 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// endpointFrom derives my endpoint and the port I listen on from the Service or Node my spec references
+func (r *nodeController) endpointFrom(ctx context.Context, srv *wgv1alpha1.Server) (endpoint string, listenPort int, err error) {
+	src := srv.Spec.EndpointFrom
+	if src.Node != nil {
+		addr, err := r.nodeAddress(orDefault(src.Node.Name, srv.HostNode()), src.Node.AddressType)
+		if err != nil {
+			return "", 0, err
+		}
+		return net.JoinHostPort(addr, strconv.Itoa(src.Node.Port)), src.Node.Port, nil
+	}
+	if src.Service == nil {
+		return "", 0, fmt.Errorf("endpointFrom sets neither service nor node")
+	}
+
+	svc := &corev1.Service{}
+	if err := r.client.Get(ctx, client.ObjectKey{Name: src.Service.Name, Namespace: srv.Namespace}, svc); err != nil {
+		return "", 0, errors.Wrapf(err, "cannot find service %s", src.Service.Name)
+	}
+	port, err := servicePort(svc, src.Service.Port)
+	if err != nil {
+		return "", 0, err
+	}
+	listenPort = int(port.Port)
+	if port.TargetPort.Type == intstr.Int && port.TargetPort.IntVal != 0 {
+		listenPort = int(port.TargetPort.IntVal)
+	}
+
+	switch svc.Spec.Type {
+	case corev1.ServiceTypeLoadBalancer:
+		for _, ingress := range svc.Status.LoadBalancer.Ingress {
+			host := ingress.IP
+			if host == "" {
+				host = ingress.Hostname
+			}
+			if host != "" {
+				return net.JoinHostPort(host, strconv.Itoa(int(port.Port))), listenPort, nil
+			}
+		}
+		return "", 0, fmt.Errorf("service %s has no load balancer ingress yet", svc.Name)
+	case corev1.ServiceTypeNodePort:
+		if port.NodePort == 0 {
+			return "", 0, fmt.Errorf("service %s has no node port allocated yet", svc.Name)
+		}
+		addr, err := r.nodeAddress(orDefault(src.Service.NodeName, srv.HostNode()), src.Service.AddressType)
+		if err != nil {
+			return "", 0, err
+		}
+		return net.JoinHostPort(addr, strconv.Itoa(int(port.NodePort))), listenPort, nil
+	default:
+		return "", 0, fmt.Errorf("service %s is of type %s, must be LoadBalancer or NodePort", svc.Name, svc.Spec.Type)
+	}
+}
+
+// servicePort finds the named port of the Service, its first one if name is empty
+func servicePort(svc *corev1.Service, name string) (corev1.ServicePort, error) {
+	for _, p := range svc.Spec.Ports {
+		if name == "" || p.Name == name {
+			return p, nil
+		}
+	}
+	if name == "" {
+		return corev1.ServicePort{}, fmt.Errorf("service %s has no ports", svc.Name)
+	}
+	return corev1.ServicePort{}, fmt.Errorf("service %s has no port %s", svc.Name, name)
+}
+
+// nodeAddress returns the Node's address of the given type, preferring ExternalIP over InternalIP if it's empty
+func (r *nodeController) nodeAddress(name string, addressType corev1.NodeAddressType) (string, error) {
+	if r.nodes == nil {
+		return "", fmt.Errorf("nodes aren't watched in this mode")
+	}
+	obj, exists, err := r.nodes.GetByKey(name)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot get node %s", name)
+	}
+	if !exists {
+		return "", fmt.Errorf("node %s not found", name)
+	}
+	node := obj.(*corev1.Node)
+
+	types := []corev1.NodeAddressType{addressType}
+	if addressType == "" {
+		types = []corev1.NodeAddressType{corev1.NodeExternalIP, corev1.NodeInternalIP}
+	}
+	for _, t := range types {
+		for _, a := range node.Status.Addresses {
+			if a.Type == t {
+				return a.Address, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s has no %s address", name, types[0])
+}
+
+// derivesEndpointFrom reports whether the server's endpoint is derived from the Service or Node
+func derivesEndpointFrom(srv *wgv1alpha1.Server, obj runtime.Object) bool {
+	src := srv.Spec.EndpointFrom
+	if src == nil {
+		return false
+	}
+	switch o := obj.(type) {
+	case *corev1.Service:
+		return src.Service != nil && src.Service.Name == o.Name
+	case *corev1.Node:
+		if src.Node != nil {
+			return orDefault(src.Node.Name, srv.HostNode()) == o.Name
+		}
+		return src.Service != nil && orDefault(src.Service.NodeName, srv.HostNode()) == o.Name
+	}
+	return false
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,79 @@
+package node
+
+import (
+	"fmt"
+)
+
+// Reasons reported in the status conditions
+const (
+	ReasonSynced                 = "Synced"
+	ReasonNeverSynced            = "NeverSynced"
+	ReasonNotFound               = "NotFound"
+	ReasonInvalidInterfaceConfig = "InvalidInterfaceConfig"
+	ReasonInvalidPeerConfig      = "InvalidPeerConfig"
+	ReasonListFailed             = "ListFailed"
+	ReasonApplyFailed            = "ApplyFailed"
+	ReasonWriteConfigFailed      = "WriteConfigFailed"
+	ReasonDeviceUnavailable      = "DeviceUnavailable"
+	ReasonSyncFailed             = "SyncFailed"
+	ReasonKeyMismatch            = "KeyMismatch"
+	ReasonPublicKeyMissing       = "PublicKeyMissing"
+	ReasonKeyMatches             = "KeyMatches"
+	ReasonKeyRotationFailed      = "KeyRotationFailed"
+	ReasonAddressPending         = "AddressPending"
+	ReasonResolved               = "Resolved"
+	ReasonResolveFailed          = "ResolveFailed"
+	ReasonEndpointUnavailable    = "EndpointUnavailable"
+	ReasonFirewallFailed         = "FirewallFailed"
+	ReasonTeardownFailed         = "TeardownFailed"
+	ReasonDryRun                 = "DryRun"
+)
+
+// failureReasons are the reasons a sync can fail with
+var failureReasons = []string{
+	ReasonNotFound,
+	ReasonInvalidInterfaceConfig,
+	ReasonInvalidPeerConfig,
+	ReasonListFailed,
+	ReasonApplyFailed,
+	ReasonWriteConfigFailed,
+	ReasonSyncFailed,
+	ReasonKeyMismatch,
+	ReasonPublicKeyMissing,
+	ReasonKeyRotationFailed,
+	ReasonAddressPending,
+	ReasonEndpointUnavailable,
+	ReasonFirewallFailed,
+	ReasonTeardownFailed,
+}
+
+// syncError carries the machine readable reason of a sync failure
+type syncError struct {
+	reason string
+	err    error
+}
+
+func (e *syncError) Error() string {
+	return e.err.Error()
+}
+
+// withReason annotates err with the condition reason
+func withReason(reason string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &syncError{reason: reason, err: err}
+}
+
+// reasonf creates new error with the condition reason
+func reasonf(reason string, format string, args ...interface{}) error {
+	return withReason(reason, fmt.Errorf(format, args...))
+}
+
+// reasonOf extracts the condition reason from err
+func reasonOf(err error) string {
+	if e, ok := err.(*syncError); ok {
+		return e.reason
+	}
+	return ReasonSyncFailed
+}
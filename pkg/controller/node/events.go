@@ -0,0 +1,212 @@
+package node
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of events on my own CR which aren't sync failures
+const (
+	ReasonApplied = "Applied"
+)
+
+// eventRepeatInterval is how long an identical event is suppressed after it has been recorded
+const eventRepeatInterval = 10 * time.Minute
+
+// eventEmitter records events on my own CR. It drops repeats of an event within eventRepeatInterval, so a
+// failing sync retried with backoff doesn't flood the object, and the broadcaster behind the recorder
+// aggregates and rate-limits what gets through on top of that. An event repeats another with the same reason
+// about the same subject, e.g. an interface or a hostname, whatever its message: messages carry details like
+// error texts or addresses which change between attempts without it being news
+type eventEmitter struct {
+	recorder record.EventRecorder
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newEventEmitter(recorder record.EventRecorder) *eventEmitter {
+	return &eventEmitter{
+		recorder: recorder,
+		now:      time.Now,
+		last:     make(map[string]time.Time),
+	}
+}
+
+// emit records the event about the subject unless it's a recent repeat. A nil emitter or object records nothing
+func (e *eventEmitter) emit(obj runtime.Object, eventType, reason, subject, message string) {
+	if e == nil || e.recorder == nil || obj == nil {
+		return
+	}
+	if !e.fresh(eventType, reason, subject) {
+		return
+	}
+	e.recorder.Event(obj, eventType, reason, message)
+}
+
+// fresh reports whether no event with the reason about the subject was recorded within eventRepeatInterval,
+// and marks it as recorded
+func (e *eventEmitter) fresh(eventType, reason, subject string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	for k, t := range e.last {
+		if now.Sub(t) >= eventRepeatInterval {
+			delete(e.last, k)
+		}
+	}
+	key := eventType + "/" + reason + "/" + subject
+	if _, ok := e.last[key]; ok {
+		return false
+	}
+	e.last[key] = now
+	return true
+}
+
+// forget lets the next events with the reasons through, e.g. a failure recurring after a successful sync
+func (e *eventEmitter) forget(reasons ...string) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for k := range e.last {
+		for _, reason := range reasons {
+			if strings.SplitN(k, "/", 3)[1] == reason {
+				delete(e.last, k)
+			}
+		}
+	}
+}
+
+// recordSync records the outcome of a sync: the failure, or the peer changes of a successful one
+func (r *nodeController) recordSync(err error) {
+	if err != nil {
+		r.events.emit(r.self, corev1.EventTypeWarning, reasonOf(err), r.Interface, err.Error())
+		return
+	}
+	r.events.forget(failureReasons...)
+	if r.changes.any() {
+		r.events.emit(r.self, corev1.EventTypeNormal, ReasonApplied, strings.Join(r.changes.interfaces, ","), r.changes.String())
+	}
+}
+
+// recordResolveFailures records the endpoint hostnames whose last lookup failed
+func (r *nodeController) recordResolveFailures() {
+	for _, f := range r.resolver.failures() {
+		r.events.emit(r.self, corev1.EventTypeWarning, ReasonResolveFailed, f.host, "cannot resolve peer endpoint "+f.message)
+	}
+}
+
+// peerChanges counts the peers applying a config adds to, removes from and updates on the interfaces
+type peerChanges struct {
+	interfaces []string
+	added      int
+	removed    int
+	updated    int
+}
+
+func (c peerChanges) any() bool {
+	return c.added+c.removed+c.updated > 0
+}
+
+func (c *peerChanges) merge(o peerChanges) {
+	c.interfaces = append(c.interfaces, o.interfaces...)
+	c.added += o.added
+	c.removed += o.removed
+	c.updated += o.updated
+}
+
+func (c peerChanges) String() string {
+	return fmt.Sprintf("applied configuration to %s: %d peers added, %d removed, %d updated",
+		strings.Join(c.interfaces, ", "), c.added, c.removed, c.updated)
+}
+
+// devicePeerChanges compares the peers to the ones on the interface. A missing interface has none
+func devicePeerChanges(b backend.Backend, iface string, peers []wgtypes.PeerConfig) (peerChanges, error) {
+	var current []wgtypes.Peer
+	dev, err := b.Device(iface)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return peerChanges{}, fmt.Errorf("cannot read device %s: %v", iface, err)
+	default:
+		current = dev.Peers
+	}
+	changes := diffPeers(current, peers)
+	changes.interfaces = []string{iface}
+	return changes, nil
+}
+
+// diffPeers counts the changes turning the current peers into the desired ones
+func diffPeers(current []wgtypes.Peer, desired []wgtypes.PeerConfig) peerChanges {
+	byKey := make(map[wgtypes.Key]wgtypes.Peer, len(current))
+	for _, p := range current {
+		byKey[p.PublicKey] = p
+	}
+	var c peerChanges
+	for _, want := range desired {
+		have, ok := byKey[want.PublicKey]
+		if !ok {
+			c.added++
+			continue
+		}
+		delete(byKey, want.PublicKey)
+		if peerDiffers(have, want) {
+			c.updated++
+		}
+	}
+	c.removed = len(byKey)
+	return c
+}
+
+// peerDiffers reports whether applying the config changes the peer. An endpoint the config leaves
+// unset is learned from the peer, and isn't a change
+func peerDiffers(have wgtypes.Peer, want wgtypes.PeerConfig) bool {
+	if want.Endpoint != nil && (have.Endpoint == nil || have.Endpoint.String() != want.Endpoint.String()) {
+		return true
+	}
+	var psk wgtypes.Key
+	if want.PresharedKey != nil {
+		psk = *want.PresharedKey
+	}
+	if have.PresharedKey != psk {
+		return true
+	}
+	var keepalive time.Duration
+	if want.PersistentKeepaliveInterval != nil {
+		keepalive = *want.PersistentKeepaliveInterval
+	}
+	if have.PersistentKeepaliveInterval != keepalive {
+		return true
+	}
+	return !sameNets(have.AllowedIPs, want.AllowedIPs)
+}
+
+func sameNets(a, b []net.IPNet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]int, len(a))
+	for _, n := range a {
+		set[n.String()]++
+	}
+	for _, n := range b {
+		if set[n.String()] == 0 {
+			return false
+		}
+		set[n.String()]--
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestDiffPeers(t *testing.T) {
+	key := func() wgtypes.Key {
+		k, _ := wgtypes.GeneratePrivateKey()
+		return k.PublicKey()
+	}
+	a, b, c, d := key(), key(), key(), key()
+	nets := func(s ...string) []net.IPNet {
+		var out []net.IPNet
+		for _, c := range s {
+			_, n, _ := net.ParseCIDR(c)
+			out = append(out, *n)
+		}
+		return out
+	}
+	endpoint := &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820}
+	keepalive := 25 * time.Second
+
+	current := []wgtypes.Peer{
+		{PublicKey: a, AllowedIPs: nets("10.0.0.1/32", "fd00::1/128"), Endpoint: endpoint},
+		{PublicKey: b, AllowedIPs: nets("10.0.0.2/32")},
+		{PublicKey: c, AllowedIPs: nets("10.0.0.3/32"), PersistentKeepaliveInterval: keepalive},
+	}
+	tests := []struct {
+		name    string
+		desired []wgtypes.PeerConfig
+		want    peerChanges
+	}{
+		{"unchanged, learned endpoint and reordered allowed IPs", []wgtypes.PeerConfig{
+			{PublicKey: a, AllowedIPs: nets("fd00::1/128", "10.0.0.1/32")},
+			{PublicKey: b, AllowedIPs: nets("10.0.0.2/32")},
+			{PublicKey: c, AllowedIPs: nets("10.0.0.3/32"), PersistentKeepaliveInterval: &keepalive},
+		}, peerChanges{}},
+		{"added and removed", []wgtypes.PeerConfig{
+			{PublicKey: a, AllowedIPs: nets("10.0.0.1/32", "fd00::1/128")},
+			{PublicKey: d, AllowedIPs: nets("10.0.0.4/32")},
+		}, peerChanges{added: 1, removed: 2}},
+		{"updated", []wgtypes.PeerConfig{
+			{PublicKey: a, AllowedIPs: nets("10.0.0.1/32")},
+			{PublicKey: b, AllowedIPs: nets("10.0.0.2/32"), Endpoint: endpoint},
+			{PublicKey: c, AllowedIPs: nets("10.0.0.3/32")},
+		}, peerChanges{updated: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffPeers(current, tt.desired)
+			if got.added != tt.want.added || got.removed != tt.want.removed || got.updated != tt.want.updated {
+				t.Errorf("diffPeers() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventEmitter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	recorder := record.NewFakeRecorder(10)
+	e := newEventEmitter(recorder)
+	e.now = func() time.Time { return now }
+	obj := &wgv1alpha1.Client{}
+
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "boom")
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "boom")
+	// a changed message about the same subject is still a repeat, another subject isn't
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "bang")
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg1", "bang")
+	now = now.Add(eventRepeatInterval)
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "boom")
+	e.emit(obj, corev1.EventTypeWarning, ReasonResolveFailed, "vpn.example.com", "vpn.example.com: timeout")
+	e.emit(obj, corev1.EventTypeWarning, ReasonResolveFailed, "vpn.example.com", "vpn.example.com: server misbehaving")
+	e.forget(failureReasons...)
+	e.emit(obj, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "boom")
+	e.emit(obj, corev1.EventTypeWarning, ReasonResolveFailed, "vpn.example.com", "vpn.example.com: timeout")
+	e.emit(nil, corev1.EventTypeWarning, ReasonApplyFailed, "wg0", "no object")
+
+	want := []string{
+		"Warning ApplyFailed boom",
+		"Warning ApplyFailed bang",
+		"Warning ApplyFailed boom",
+		"Warning ResolveFailed vpn.example.com: timeout",
+		"Warning ApplyFailed boom",
+		"Warning ResolveFailed vpn.example.com: timeout",
+	}
+	close(recorder.Events)
+	var got []string
+	for ev := range recorder.Events {
+		got = append(got, ev)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("recorded %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package node
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/firewall"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// firewallRules compiles my firewall settings on the interface: masquerading, and isolation of my client peers
+// selected by a PeerPolicy. Only servers have any. It also returns the names of the isolated clients, which
+// mustn't be peered with unless the rules are in place
+func (r *nodeController) firewallRules(ctx context.Context, me wgv1alpha1.VPNNode, iface string, peers []wgv1alpha1.VPNNode, log logrus.FieldLogger) (firewall.Ruleset, map[string]bool, error) {
+	rs := firewall.Ruleset{Interface: iface}
+	srv, ok := me.(*wgv1alpha1.Server)
+	if !ok {
+		return rs, nil, nil
+	}
+	if srv.Spec.Masquerade != nil {
+		sources, err := srv.MasqueradeSources()
+		if err != nil {
+			return rs, nil, reasonf(ReasonInvalidInterfaceConfig, "cannot create firewall rules: %v", err)
+		}
+		if len(sources) > 0 {
+			rs.Masquerade = append(rs.Masquerade, firewall.Masquerade{EgressInterface: srv.Spec.Masquerade.EgressInterface, Sources: sources})
+		}
+	}
+
+	policies := &wgv1alpha1.PeerPolicyList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, policies); err != nil {
+		return rs, nil, reasonf(ReasonListFailed, "cannot list peer policies: %v", err)
+	}
+	if len(policies.Items) == 0 {
+		return rs, nil, nil
+	}
+	var clients []*wgv1alpha1.Client
+	for _, p := range peers {
+		if cl, ok := p.(*wgv1alpha1.Client); ok {
+			clients = append(clients, cl)
+		}
+	}
+	// chains are numbered in client name order, so the rules only change along with the policies
+	sort.Slice(clients, func(i, j int) bool { return clients[i].Name < clients[j].Name })
+	restricted := make(map[string]bool)
+	for _, cl := range clients {
+		iso, isolated, err := isolation(srv, cl, policies.Items, log)
+		if err != nil {
+			return rs, nil, reasonf(ReasonInvalidPeerConfig, "cannot isolate client %s: %v", cl.Name, err)
+		}
+		if isolated {
+			rs.Isolation = append(rs.Isolation, iso)
+			restricted[cl.Name] = true
+		}
+	}
+	return rs, restricted, nil
+}
+
+// withoutRestricted returns the peers but those of restricted nodes, looked up in names by public key
+func withoutRestricted(peers []wgtypes.PeerConfig, names map[wgtypes.Key]string, restricted map[string]bool) []wgtypes.PeerConfig {
+	kept := make([]wgtypes.PeerConfig, 0, len(peers))
+	for _, p := range peers {
+		if !restricted[names[p.PublicKey]] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// isolation compiles the policies applying to the client on the server. Invalid policies are skipped, the
+// client stays isolated and reaches less rather than more
+func isolation(srv *wgv1alpha1.Server, cl *wgv1alpha1.Client, policies []wgv1alpha1.PeerPolicy, log logrus.FieldLogger) (iso firewall.Isolation, isolated bool, err error) {
+	for i := range policies {
+		p := &policies[i]
+		plog := log.WithField("policy", p.Name).WithField("client", cl.Name)
+		ok, err := p.Applies(srv, cl)
+		if err != nil {
+			plog.WithError(err).Warnln("skipping peer policy with invalid selector")
+			continue
+		}
+		if !ok {
+			continue
+		}
+		isolated = true
+		if err := p.Validate(); err != nil {
+			plog.WithError(err).Warnln("skipping rules of invalid peer policy")
+			continue
+		}
+		for _, rule := range p.Spec.Egress {
+			d := firewall.Destination{}
+			for _, c := range rule.CIDRs {
+				n, err := wgv1alpha1.ParseCIDR(c)
+				if err != nil {
+					return iso, false, err
+				}
+				d.CIDRs = append(d.CIDRs, n)
+			}
+			for _, port := range rule.Ports {
+				proto := strings.ToLower(string(port.Protocol))
+				if proto == "" {
+					proto = "tcp"
+				}
+				d.Ports = append(d.Ports, firewall.Port{Protocol: proto, Port: port.Port, EndPort: port.EndPort})
+			}
+			iso.Allowed = append(iso.Allowed, d)
+		}
+	}
+	if !isolated {
+		return iso, false, nil
+	}
+	for _, a := range cl.Spec.AllowedIPs {
+		n, err := wgv1alpha1.ParseCIDR(a)
+		if err != nil {
+			return iso, false, err
+		}
+		iso.Sources = append(iso.Sources, n)
+	}
+	return iso, true, nil
+}
+
+// syncFirewall replaces my tables on the interface with the ruleset. Nodes which never had any rules skip
+// it after the first sync, which clears leftovers e.g. from before a crash
+func (r *nodeController) syncFirewall(rs firewall.Ruleset, log logrus.FieldLogger) error {
+	if rs.Empty() && !r.firewallInstalled {
+		return nil
+	}
+	if r.DryRun || !r.Backend.ConfiguresHost() {
+		log.Infof("Not configuring the host, not applying firewall rules:\n%s", firewall.Render(rs))
+		return nil
+	}
+	if err := firewall.Apply(rs); err != nil {
+		return reasonf(ReasonFirewallFailed, "cannot apply firewall rules on %s: %v", rs.Interface, err)
+	}
+	r.firewallInstalled = !rs.Empty()
+	return nil
+}
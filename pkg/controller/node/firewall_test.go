@@ -0,0 +1,24 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+)
+
+func Test_withoutRestricted(t *testing.T) {
+	laptop, _ := wgtypes.GenerateKey()
+	laptopNext, _ := wgtypes.GenerateKey()
+	gateway, _ := wgtypes.GenerateKey()
+	unnamed, _ := wgtypes.GenerateKey()
+	names := map[wgtypes.Key]string{laptop: "laptop", laptopNext: "laptop", gateway: "gateway"}
+	peers := []wgtypes.PeerConfig{{PublicKey: laptop}, {PublicKey: gateway}, {PublicKey: laptopNext}, {PublicKey: unnamed}}
+
+	got := withoutRestricted(peers, names, map[string]bool{"laptop": true})
+	if len(got) != 2 || got[0].PublicKey != gateway || got[1].PublicKey != unnamed {
+		t.Errorf("withoutRestricted() = %v, want gateway and the unnamed peer", got)
+	}
+	if got := withoutRestricted(peers, names, nil); len(got) != len(peers) {
+		t.Errorf("withoutRestricted() without restrictions kept %d peers, want %d", len(got), len(peers))
+	}
+}
@@ -0,0 +1,191 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// healthState is the sync state served on the health endpoints. The health server reads it concurrently
+// with the loop updating it, so it has its own lock
+type healthState struct {
+	mu sync.Mutex
+	// last time the loop went around, zero until it starts
+	heartbeat   time.Time
+	lastSync    time.Time
+	lastSuccess time.Time
+	lastErr     error
+	// start of the current streak of failed syncs
+	dirtySince time.Time
+}
+
+// beat records that the loop is alive
+func (h *healthState) beat(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeat = now
+}
+
+// synced records the outcome of a sync
+func (h *healthState) synced(now time.Time, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heartbeat = now
+	h.lastSync = now
+	h.lastErr = err
+	switch {
+	case err == nil:
+		h.lastSuccess = now
+		h.dirtySince = time.Time{}
+	case h.dirtySince.IsZero():
+		h.dirtySince = now
+	}
+}
+
+// everSucceeded reports whether any sync succeeded
+func (h *healthState) everSucceeded() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.lastSuccess.IsZero()
+}
+
+// stuck reports for how long the loop hasn't gone around, if that's longer than timeout
+func (h *healthState) stuck(now time.Time, timeout time.Duration) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.heartbeat.IsZero() {
+		return 0, false
+	}
+	since := now.Sub(h.heartbeat)
+	return since, since > timeout
+}
+
+// interfaceHealth is the health of a single interface, as served on the health endpoints
+type interfaceHealth struct {
+	Interface              string     `json:"interface"`
+	Healthy                bool       `json:"healthy"`
+	Ready                  bool       `json:"ready"`
+	Message                string     `json:"message,omitempty"`
+	LastSyncTime           *time.Time `json:"lastSyncTime,omitempty"`
+	LastSuccessfulSyncTime *time.Time `json:"lastSuccessfulSyncTime,omitempty"`
+	LastError              string     `json:"lastError,omitempty"`
+	Reason                 string     `json:"reason,omitempty"`
+}
+
+// report checks the state: the loop is unhealthy if it hasn't gone around for stuckTimeout, and the interface
+// is unready until the first successful sync, or if syncs keep failing for longer than unreadyTimeout
+func (h *healthState) report(iface string, now time.Time, stuckTimeout, unreadyTimeout time.Duration) interfaceHealth {
+	since, stuck := h.stuck(now, stuckTimeout)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rep := interfaceHealth{Interface: iface, Healthy: true, Ready: true}
+	if !h.lastSync.IsZero() {
+		t := h.lastSync
+		rep.LastSyncTime = &t
+	}
+	if !h.lastSuccess.IsZero() {
+		t := h.lastSuccess
+		rep.LastSuccessfulSyncTime = &t
+	}
+	if h.lastErr != nil {
+		rep.LastError = h.lastErr.Error()
+		rep.Reason = reasonOf(h.lastErr)
+	}
+
+	var problems []string
+	if stuck {
+		rep.Healthy = false
+		rep.Ready = false
+		problems = append(problems, fmt.Sprintf("sync loop stuck for %s", since.Round(time.Second)))
+	}
+	switch {
+	case h.lastSuccess.IsZero():
+		rep.Ready = false
+		problems = append(problems, "waiting for the first successful sync")
+	case !h.dirtySince.IsZero() && now.Sub(h.dirtySince) > unreadyTimeout:
+		rep.Ready = false
+		problems = append(problems, fmt.Sprintf("syncs failing for %s", now.Sub(h.dirtySince).Round(time.Second)))
+	}
+	rep.Message = strings.Join(problems, "; ")
+	return rep
+}
+
+// healthServer serves /healthz, failing while the agent's or a controller's loop is stuck so the agent gets
+// restarted, and /readyz, failing until all interfaces are configured or while one of them keeps failing to sync
+type healthServer struct {
+	agent *agent
+	addr  string
+}
+
+var _ manager.Runnable = (*healthServer)(nil)
+
+// healthReport is the body of the health endpoints
+type healthReport struct {
+	Healthy    bool              `json:"healthy"`
+	Ready      bool              `json:"ready"`
+	Message    string            `json:"message,omitempty"`
+	Interfaces []interfaceHealth `json:"interfaces"`
+}
+
+func (s *healthServer) report(now time.Time) healthReport {
+	a := s.agent
+	// the loops wake up at least every status interval, being stuck counts from there
+	stuckTimeout := a.StatusInterval + a.StuckTimeout
+	rep := healthReport{Healthy: true, Ready: true, Interfaces: []interfaceHealth{}}
+	if since, stuck := a.health.stuck(now, stuckTimeout); stuck {
+		rep.Healthy = false
+		rep.Ready = false
+		rep.Message = fmt.Sprintf("agent loop stuck for %s", since.Round(time.Second))
+	}
+	for _, ctl := range a.controllers() {
+		ih := ctl.health.report(ctl.Interface, now, stuckTimeout, a.UnreadyTimeout)
+		rep.Healthy = rep.Healthy && ih.Healthy
+		rep.Ready = rep.Ready && ih.Ready
+		rep.Interfaces = append(rep.Interfaces, ih)
+	}
+	if len(rep.Interfaces) == 0 && rep.Message == "" {
+		rep.Ready = false
+		rep.Message = "no interfaces to manage"
+	}
+	sort.Slice(rep.Interfaces, func(i, j int) bool {
+		return rep.Interfaces[i].Interface < rep.Interfaces[j].Interface
+	})
+	return rep
+}
+
+func (s *healthServer) handler(ok func(healthReport) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		rep := s.report(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		if !ok(rep) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(rep); err != nil {
+			logrus.WithError(err).Warnln("cannot write health report")
+		}
+	}
+}
+
+func (s *healthServer) Start(done <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", s.handler(func(rep healthReport) bool { return rep.Healthy }))
+	mux.Handle("/readyz", s.handler(func(rep healthReport) bool { return rep.Ready }))
+	srv := &http.Server{Addr: s.addr, Handler: mux}
+	go func() {
+		<-done
+		srv.Close()
+	}()
+	logrus.WithField("addr", s.addr).Infoln("serving health endpoints")
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
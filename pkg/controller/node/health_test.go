@@ -0,0 +1,53 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHealthState_report(t *testing.T) {
+	start := time.Unix(1000, 0)
+	failed := withReason(ReasonApplyFailed, errors.New("boom"))
+	tests := []struct {
+		name        string
+		events      func(h *healthState)
+		at          time.Duration
+		wantHealthy bool
+		wantReady   bool
+		wantReason  string
+	}{
+		{"not started", func(h *healthState) {}, time.Hour, true, false, ""},
+		{"waiting for the first sync", func(h *healthState) { h.beat(start) }, time.Second, true, false, ""},
+		{"first sync failed", func(h *healthState) { h.synced(start, failed) }, time.Second, true, false, ReasonApplyFailed},
+		{"synced", func(h *healthState) { h.synced(start, nil) }, time.Second, true, true, ""},
+		{"failing shortly", func(h *healthState) {
+			h.synced(start, nil)
+			h.synced(start.Add(time.Second), failed)
+		}, 30 * time.Second, true, true, ReasonApplyFailed},
+		{"failing for too long", func(h *healthState) {
+			h.synced(start, nil)
+			h.synced(start.Add(time.Second), failed)
+			h.synced(start.Add(time.Minute), failed)
+			h.beat(start.Add(90 * time.Second))
+		}, 2 * time.Minute, true, false, ReasonApplyFailed},
+		{"recovered", func(h *healthState) {
+			h.synced(start, failed)
+			h.synced(start.Add(time.Minute), nil)
+		}, 2 * time.Minute, true, true, ""},
+		{"stuck", func(h *healthState) { h.synced(start, nil) }, 10 * time.Minute, false, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &healthState{}
+			tt.events(h)
+			got := h.report("wg0", start.Add(tt.at), 5*time.Minute, time.Minute)
+			if got.Healthy != tt.wantHealthy || got.Ready != tt.wantReady {
+				t.Errorf("report() healthy = %v, ready = %v, want %v, %v: %s", got.Healthy, got.Ready, tt.wantHealthy, tt.wantReady, got.Message)
+			}
+			if got.Reason != tt.wantReason {
+				t.Errorf("report() reason = %s, want %s", got.Reason, tt.wantReason)
+			}
+		})
+	}
+}
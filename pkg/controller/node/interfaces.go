@@ -0,0 +1,148 @@
+package node
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// InterfaceConfig is a wireguard interface managed by the agent, configured from one of my Server or Client CRs
+type InterfaceConfig struct {
+	Name string
+	// NodeName of the CR configuring the interface
+	NodeName       string
+	Mode           Mode
+	PrivateKeyFile string
+	RouteTable     int
+	RouteMetric    int
+}
+
+// interfaceEntry is an interface in the interfaces file. Unset fields default to the agent's flags
+type interfaceEntry struct {
+	Name           string `json:"name"`
+	NodeName       string `json:"nodeName,omitempty"`
+	Mode           string `json:"mode,omitempty"`
+	PrivateKeyFile string `json:"privateKeyFile,omitempty"`
+	RouteTable     *int   `json:"routeTable,omitempty"`
+	RouteMetric    *int   `json:"routeMetric,omitempty"`
+}
+
+type interfacesFile struct {
+	Interfaces []interfaceEntry `json:"interfaces"`
+}
+
+// ParseMode parses the agent's mode
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "server":
+		return Server, nil
+	case "client":
+		return Client, nil
+	case "auto":
+		return Auto, nil
+	default:
+		return Unset, fmt.Errorf("unknown mode %q", s)
+	}
+}
+
+// defaultKeyFile keeps the agent's key file for its own interface and puts the keys of other interfaces next to it
+func defaultKeyFile(config NodeControllerConfig, iface string) string {
+	if iface == config.Interface {
+		return config.PrivateKeyFile
+	}
+	return path.Join(path.Dir(config.PrivateKeyFile), iface+".key")
+}
+
+// defaultInterface configures the interface with the agent's settings
+func defaultInterface(config NodeControllerConfig, iface, nodeName string) InterfaceConfig {
+	return InterfaceConfig{
+		Name:           iface,
+		NodeName:       nodeName,
+		Mode:           config.Mode,
+		PrivateKeyFile: defaultKeyFile(config, iface),
+		RouteTable:     config.RouteTable,
+		RouteMetric:    config.RouteMetric,
+	}
+}
+
+// ReadInterfacesFile reads the interfaces the agent manages from a YAML or JSON file, filling in unset fields from config
+func ReadInterfacesFile(file string, config NodeControllerConfig) ([]InterfaceConfig, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := interfacesFile{}
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", file, err)
+	}
+
+	seen := make(map[string]bool)
+	ifaces := make([]InterfaceConfig, 0, len(f.Interfaces))
+	for i, e := range f.Interfaces {
+		if e.Name == "" {
+			return nil, fmt.Errorf("interface %d has no name", i)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("interface %s declared twice", e.Name)
+		}
+		seen[e.Name] = true
+
+		nodeName := e.NodeName
+		if nodeName == "" {
+			nodeName = config.NodeName
+		}
+		ic := defaultInterface(config, e.Name, nodeName)
+		if e.Mode != "" {
+			if ic.Mode, err = ParseMode(e.Mode); err != nil {
+				return nil, fmt.Errorf("interface %s: %v", e.Name, err)
+			}
+		}
+		if e.PrivateKeyFile != "" {
+			ic.PrivateKeyFile = e.PrivateKeyFile
+		}
+		if e.RouteTable != nil {
+			ic.RouteTable = *e.RouteTable
+		}
+		if e.RouteMetric != nil {
+			ic.RouteMetric = *e.RouteMetric
+		}
+		ifaces = append(ifaces, ic)
+	}
+	return ifaces, nil
+}
+
+// readState returns the interfaces recorded as created by the agent, one per line
+func readState(file string) (map[string]bool, error) {
+	state := make(map[string]bool)
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			state[line] = true
+		}
+	}
+	return state, nil
+}
+
+func writeState(file string, state map[string]bool) error {
+	ifaces := make([]string, 0, len(state))
+	for iface := range state {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+	var b strings.Builder
+	for _, iface := range ifaces {
+		b.WriteString(iface + "\n")
+	}
+	return ioutil.WriteFile(file, []byte(b.String()), 0644)
+}
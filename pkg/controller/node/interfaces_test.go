@@ -0,0 +1,88 @@
+package node
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestReadInterfacesFile(t *testing.T) {
+	defaults := NodeControllerConfig{
+		NodeName:       "node-1",
+		Interface:      "wg0",
+		PrivateKeyFile: "/etc/wireguard/wg0.key",
+		Mode:           Server,
+		RouteTable:     0,
+		RouteMetric:    100,
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []InterfaceConfig
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			content: "interfaces:\n- name: wg0\n- name: wg-lab\n",
+			want: []InterfaceConfig{
+				{Name: "wg0", NodeName: "node-1", Mode: Server, PrivateKeyFile: "/etc/wireguard/wg0.key", RouteMetric: 100},
+				{Name: "wg-lab", NodeName: "node-1", Mode: Server, PrivateKeyFile: "/etc/wireguard/wg-lab.key", RouteMetric: 100},
+			},
+		},
+		{
+			name: "overrides",
+			content: "interfaces:\n- name: wg-lab\n  nodeName: node-1-lab\n  mode: client\n" +
+				"  privateKeyFile: /keys/lab.key\n  routeTable: 100\n  routeMetric: 0\n",
+			want: []InterfaceConfig{
+				{Name: "wg-lab", NodeName: "node-1-lab", Mode: Client, PrivateKeyFile: "/keys/lab.key", RouteTable: 100},
+			},
+		},
+		{name: "missing name", content: "interfaces:\n- mode: client\n", wantErr: true},
+		{name: "duplicate", content: "interfaces:\n- name: wg0\n- name: wg0\n", wantErr: true},
+		{name: "unknown mode", content: "interfaces:\n- name: wg0\n  mode: hub\n", wantErr: true},
+	}
+
+	dir, err := ioutil.TempDir("", "interfaces")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := path.Join(dir, "interfaces.yaml")
+			if err := ioutil.WriteFile(file, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadInterfacesFile(file, defaults)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadInterfacesFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadInterfacesFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "interfaces")
+
+	state, err := readState(file)
+	if err != nil || len(state) != 0 {
+		t.Fatalf("readState() of a missing file = %v, %v, want empty state", state, err)
+	}
+	want := map[string]bool{"wg0": true, "wg-lab": true}
+	if err := writeState(file, want); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readState(file); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("readState() = %v, %v, want %v", got, err, want)
+	}
+}
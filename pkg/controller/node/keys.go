@@ -0,0 +1,82 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+// readPrivateKey reads wireguard private key from file. If it doesn't exist and generate is set
+// a new key is generated and written with 0600 permissions
+func readPrivateKey(file string, generate bool, log logrus.FieldLogger) (wgtypes.Key, error) {
+	data, err := ioutil.ReadFile(file)
+	switch {
+	case err == nil:
+		return wgquick.ParseKey(string(data))
+	case os.IsNotExist(err) && generate:
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return wgtypes.Key{}, fmt.Errorf("cannot generate private key: %v", err)
+		}
+		if err := writePrivateKey(file, key); err != nil {
+			return wgtypes.Key{}, err
+		}
+		log.WithField("file", file).Infoln("generated new private key")
+		return key, nil
+	default:
+		return wgtypes.Key{}, err
+	}
+}
+
+// writePrivateKey atomically replaces the key file
+func writePrivateKey(file string, key wgtypes.Key) error {
+	if err := os.MkdirAll(path.Dir(file), 0700); err != nil {
+		return fmt.Errorf("cannot create key directory: %v", err)
+	}
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(key.String()+"\n"), 0600); err != nil {
+		return fmt.Errorf("cannot write private key to %s: %v", tmp, err)
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return fmt.Errorf("cannot move private key to %s: %v", file, err)
+	}
+	return nil
+}
+
+// reconcileKey makes sure the local private key matches the public key published in my CR.
+// With GeneratePrivateKey set, a missing key is generated and a missing public key is published.
+func (r *nodeController) reconcileKey(ctx context.Context, me wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	key, err := readPrivateKey(r.PrivateKeyFile, r.GeneratePrivateKey, log)
+	if err != nil {
+		return reasonf(ReasonInvalidInterfaceConfig, "cannot read private key %s: %v", r.PrivateKeyFile, err)
+	}
+	pub := key.PublicKey().String()
+	spec := me.GetCommonSpec()
+
+	switch {
+	case spec.PublicKey == pub:
+		return nil
+	case spec.PendingPublicKey == pub:
+		// key rotation switched the key file, but the promoted public key isn't visible yet
+		return nil
+	case spec.PublicKey == "":
+		if !r.GeneratePrivateKey {
+			return reasonf(ReasonPublicKeyMissing, "public key is not set and --generate-private-key is disabled")
+		}
+		spec.PublicKey = pub
+		if err := r.client.Update(ctx, me); err != nil {
+			return reasonf(ReasonPublicKeyMissing, "cannot publish public key: %v", err)
+		}
+		log.WithField("public_key", pub).Infoln("published public key")
+		return nil
+	default:
+		return reasonf(ReasonKeyMismatch, "public key %s doesn't match local private key %s (public key %s)", spec.PublicKey, r.PrivateKeyFile, pub)
+	}
+}
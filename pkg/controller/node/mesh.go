@@ -0,0 +1,54 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// meshKeepalive keeps NAT mappings open from mesh nodes without an endpoint towards the ones with it
+const meshKeepalive = 25 * time.Second
+
+// meshPeerConfig generates peer configs for every other mesh client of my network. A pair where neither side
+// has an endpoint can never handshake, so such peers are skipped
+func (r *nodeController) meshPeerConfig(ctx context.Context, me *wgv1alpha1.Client, network *wgv1alpha1.Network, ps *peerSet, log logrus.FieldLogger) ([]wgtypes.PeerConfig, error) {
+	clients := &wgv1alpha1.ClientList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, clients); err != nil {
+		return nil, reasonf(ReasonListFailed, "cannot list all clients: %v", err)
+	}
+
+	var peers []wgtypes.PeerConfig
+	for i := range clients.Items {
+		cl := &clients.Items[i]
+		if cl.Name == me.Name || terminating(cl) || !wgv1alpha1.SameNetwork(cl, me) || !cl.Meshes(network) {
+			continue
+		}
+		if cl.Spec.PublicKey == "" {
+			log.WithField("client", cl.Name).Warnln("skipping mesh peer without public key")
+			continue
+		}
+		if cl.Spec.Endpoint == "" && me.Spec.Endpoint == "" {
+			log.WithField("client", cl.Name).Debugln("skipping mesh peer, neither side has an endpoint")
+			continue
+		}
+		clPeers, err := ps.add(cl)
+		if err == errUnresolved {
+			log.WithField("client", cl.Name).Warnln("skipping mesh peer whose endpoint hasn't resolved yet")
+			continue
+		} else if err != nil {
+			return nil, reasonf(ReasonInvalidPeerConfig, "cannot generate peer config for mesh peer %s: %v", cl.Name, err)
+		}
+		// with both endpoints known either side can initiate, keepalives only matter when I'm unreachable
+		if d, ok := keepalive(me, network); ok {
+			setKeepalive(clPeers, d)
+		} else if me.Spec.Endpoint == "" {
+			setKeepalive(clPeers, meshKeepalive)
+		}
+		peers = append(peers, clPeers...)
+	}
+	return peers, nil
+}
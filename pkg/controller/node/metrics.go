@@ -0,0 +1,177 @@
+package node
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	syncFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wg_operator",
+		Name:      "sync_consecutive_failures",
+		Help:      "Number of consecutive failed syncs, 0 after a successful one",
+	}, []string{"interface"})
+	syncBackoff = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wg_operator",
+		Name:      "sync_backoff_seconds",
+		Help:      "Current delay before the next sync retry, 0 when not backing off",
+	}, []string{"interface"})
+	syncNextRetry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wg_operator",
+		Name:      "sync_next_retry_timestamp_seconds",
+		Help:      "Unix time of the next scheduled sync retry, 0 when not backing off",
+	}, []string{"interface"})
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "wg_operator",
+		Name:      "sync_duration_seconds",
+		Help:      "Duration of syncs, successful or not",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"interface"})
+	syncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wg_operator",
+		Name:      "sync_errors_total",
+		Help:      "Number of failed syncs by the reason of the failure",
+	}, []string{"interface", "reason"})
+	coalescedUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wg_operator",
+		Name:      "coalesced_updates_total",
+		Help:      "Number of update events merged into a sync triggered by an earlier one",
+	}, []string{"interface"})
+	syncDirty = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wg_operator",
+		Name:      "dirty",
+		Help:      "1 while the last sync failed and the interface may not match the desired configuration",
+	}, []string{"interface"})
+	driftDetected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "wg_operator",
+		Name:      "drift_detected",
+		Help:      "1 if the last drift check found the interface deviating from its applied config",
+	}, []string{"interface"})
+	driftTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "wg_operator",
+		Name:      "drift_total",
+		Help:      "Number of drift checks finding the interface deviating from its applied config, by the part deviating",
+	}, []string{"interface", "kind"})
+
+	peerStats = newPeerMetrics()
+)
+
+func init() {
+	metrics.Registry.MustRegister(syncFailures, syncBackoff, syncNextRetry, syncDuration, syncErrors, coalescedUpdates, syncDirty,
+		driftDetected, driftTotal, peerStats)
+}
+
+// forgetInterface drops the metrics of a removed interface
+func forgetInterface(iface string) {
+	syncFailures.DeleteLabelValues(iface)
+	syncBackoff.DeleteLabelValues(iface)
+	syncNextRetry.DeleteLabelValues(iface)
+	syncDuration.DeleteLabelValues(iface)
+	coalescedUpdates.DeleteLabelValues(iface)
+	syncDirty.DeleteLabelValues(iface)
+	for _, reason := range failureReasons {
+		syncErrors.DeleteLabelValues(iface, reason)
+	}
+	driftDetected.DeleteLabelValues(iface)
+	for _, kind := range driftKinds {
+		driftTotal.DeleteLabelValues(iface, kind)
+	}
+	peerStats.forget(iface)
+}
+
+// peerSample is the state of a peer as last read from the device
+type peerSample struct {
+	name      string
+	publicKey string
+	rx, tx    int64
+	handshake time.Time
+}
+
+// peerMetrics exports the peer state read from the devices on every status update. The handshake age
+// is computed on scrape, so it keeps growing between updates and stale handshakes alert on time
+type peerMetrics struct {
+	mu     sync.Mutex
+	peers  map[string][]peerSample
+	counts map[string]int
+	now    func() time.Time
+
+	rx, tx, handshakeAge, count *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*peerMetrics)(nil)
+
+func newPeerMetrics() *peerMetrics {
+	labels := []string{"interface", "peer", "public_key"}
+	return &peerMetrics{
+		peers:  make(map[string][]peerSample),
+		counts: make(map[string]int),
+		now:    time.Now,
+		rx: prometheus.NewDesc("wg_operator_peer_receive_bytes_total",
+			"Bytes received from the peer, as reported by the device", labels, nil),
+		tx: prometheus.NewDesc("wg_operator_peer_transmit_bytes_total",
+			"Bytes sent to the peer, as reported by the device", labels, nil),
+		handshakeAge: prometheus.NewDesc("wg_operator_peer_last_handshake_age_seconds",
+			"Seconds since the last handshake with the peer, +Inf if there was none", labels, nil),
+		count: prometheus.NewDesc("wg_operator_peers",
+			"Number of peers configured on the device", []string{"interface"}, nil),
+	}
+}
+
+// set replaces the peers of the interface. Peers unknown to me are left out, they have no CR name
+func (m *peerMetrics) set(iface string, peers []wgtypes.Peer, names map[wgtypes.Key]string) {
+	samples := make([]peerSample, 0, len(peers))
+	for _, p := range peers {
+		name, ok := names[p.PublicKey]
+		if !ok {
+			continue
+		}
+		samples = append(samples, peerSample{
+			name:      name,
+			publicKey: p.PublicKey.String(),
+			rx:        p.ReceiveBytes,
+			tx:        p.TransmitBytes,
+			handshake: p.LastHandshakeTime,
+		})
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.peers[iface] = samples
+	m.counts[iface] = len(peers)
+}
+
+func (m *peerMetrics) forget(iface string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.peers, iface)
+	delete(m.counts, iface)
+}
+
+func (m *peerMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- m.rx
+	ch <- m.tx
+	ch <- m.handshakeAge
+	ch <- m.count
+}
+
+func (m *peerMetrics) Collect(ch chan<- prometheus.Metric) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for iface, samples := range m.peers {
+		ch <- prometheus.MustNewConstMetric(m.count, prometheus.GaugeValue, float64(m.counts[iface]), iface)
+		for _, s := range samples {
+			age := math.Inf(1)
+			if !s.handshake.IsZero() {
+				age = now.Sub(s.handshake).Seconds()
+			}
+			ch <- prometheus.MustNewConstMetric(m.rx, prometheus.CounterValue, float64(s.rx), iface, s.name, s.publicKey)
+			ch <- prometheus.MustNewConstMetric(m.tx, prometheus.CounterValue, float64(s.tx), iface, s.name, s.publicKey)
+			ch <- prometheus.MustNewConstMetric(m.handshakeAge, prometheus.GaugeValue, age, iface, s.name, s.publicKey)
+		}
+	}
+}
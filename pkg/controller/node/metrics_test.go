@@ -0,0 +1,72 @@
+package node
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestPeerMetrics(t *testing.T) {
+	now := time.Unix(1000, 0)
+	known, _ := wgtypes.GeneratePrivateKey()
+	fresh, _ := wgtypes.GeneratePrivateKey()
+	unknown, _ := wgtypes.GeneratePrivateKey()
+
+	m := newPeerMetrics()
+	m.now = func() time.Time { return now }
+	m.set("wg0", []wgtypes.Peer{
+		{PublicKey: known.PublicKey(), ReceiveBytes: 10, TransmitBytes: 20, LastHandshakeTime: now.Add(-90 * time.Second)},
+		{PublicKey: fresh.PublicKey()},
+		{PublicKey: unknown.PublicKey(), ReceiveBytes: 5},
+	}, map[wgtypes.Key]string{known.PublicKey(): "foo", fresh.PublicKey(): "bar"})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(m)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, f := range families {
+		for _, metric := range f.GetMetric() {
+			key := f.GetName()
+			for _, l := range metric.GetLabel() {
+				if l.GetName() == "peer" {
+					key += "/" + l.GetValue()
+				}
+			}
+			switch {
+			case metric.Counter != nil:
+				got[key] = metric.GetCounter().GetValue()
+			case metric.Gauge != nil:
+				got[key] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	want := map[string]float64{
+		"wg_operator_peers":                               3,
+		"wg_operator_peer_receive_bytes_total/foo":        10,
+		"wg_operator_peer_transmit_bytes_total/foo":       20,
+		"wg_operator_peer_last_handshake_age_seconds/foo": 90,
+		"wg_operator_peer_receive_bytes_total/bar":        0,
+		"wg_operator_peer_transmit_bytes_total/bar":       0,
+		"wg_operator_peer_last_handshake_age_seconds/bar": math.Inf(1),
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d series, want %d: %v", len(got), len(want), got)
+	}
+	for k, v := range want {
+		if g, ok := got[k]; !ok || g != v {
+			t.Errorf("%s = %v, want %v", k, g, v)
+		}
+	}
+
+	m.forget("wg0")
+	if families, _ := reg.Gather(); len(families) != 0 {
+		t.Errorf("forgotten interface still exported: %v", families)
+	}
+}
@@ -0,0 +1,80 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// fetchNetwork returns the network the node belongs to, nil for the default network
+func fetchNetwork(ctx context.Context, c client.Client, namespace string, me wgv1alpha1.VPNNode) (*wgv1alpha1.Network, error) {
+	name := me.GetCommonSpec().Network
+	if name == "" {
+		return nil, nil
+	}
+	network := &wgv1alpha1.Network{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, network); err != nil {
+		return nil, withReason(ReasonNotFound, errors.Wrapf(err, "cannot find network %s", name))
+	}
+	return network, nil
+}
+
+// addressPool is the pool the node's addresses are allocated from, if any
+func addressPool(me wgv1alpha1.VPNNode, network *wgv1alpha1.Network) string {
+	if pool := me.GetCommonSpec().AddressPool; pool != "" || network == nil {
+		return pool
+	}
+	return network.Spec.AddressPool
+}
+
+// applyNetwork fills in interface settings the node leaves to its network
+func applyNetwork(cfg *wgquick.Config, me wgv1alpha1.VPNNode, network *wgv1alpha1.Network) error {
+	if network == nil {
+		return nil
+	}
+	spec := me.GetCommonSpec()
+	if spec.MTU == 0 {
+		cfg.MTU = network.Spec.MTU
+	}
+	if len(spec.DNS) == 0 {
+		for _, d := range network.Spec.DNS {
+			ip := net.ParseIP(d)
+			if ip == nil {
+				return fmt.Errorf("cannot parse dns %s", d)
+			}
+			cfg.DNS = append(cfg.DNS, ip)
+		}
+	}
+	if cfg.ListenPort == nil && network.Spec.ListenPort != 0 {
+		port := network.Spec.ListenPort
+		cfg.ListenPort = &port
+	}
+	return nil
+}
+
+// keepalive returns the persistent keepalive I send towards my peers, set by me or else by my network.
+// ok is false if neither overrides the default
+func keepalive(me wgv1alpha1.VPNNode, network *wgv1alpha1.Network) (d time.Duration, ok bool) {
+	seconds := me.GetCommonSpec().PersistentKeepalive
+	if seconds == nil && network != nil {
+		seconds = network.Spec.PersistentKeepalive
+	}
+	if seconds == nil {
+		return 0, false
+	}
+	return time.Duration(*seconds) * time.Second, true
+}
+
+// setKeepalive sets the peers' persistent keepalive, 0 disables it
+func setKeepalive(peers []wgtypes.PeerConfig, d time.Duration) {
+	for i := range peers {
+		peers[i].PersistentKeepaliveInterval = &d
+	}
+}
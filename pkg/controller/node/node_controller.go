@@ -6,20 +6,25 @@ import (
 	"fmt"
 	"io/ioutil"
 	"path"
+	"sync"
 	"time"
 
 	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
 	"github.com/mdlayher/wireguardctrl/wgtypes"
 	"github.com/nmiculinic/wg-quick-go"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
-	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
-	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
@@ -29,6 +34,8 @@ const (
 	Unset  Mode = iota
 	Server      = iota
 	Client      = iota
+	// Auto configures whichever Server and Client CRs carry the node's name
+	Auto = iota
 )
 
 type NodeControllerConfig struct {
@@ -44,22 +51,37 @@ type NodeControllerConfig struct {
 	DryRun         bool
 	SyncConfigPath string
 	SyncConfig     bool
-}
-
-func (n *NodeControllerConfig) Create(ev event.CreateEvent) bool {
-	return ev.Meta.GetName() == n.NodeName
-}
-
-func (n *NodeControllerConfig) Delete(ev event.DeleteEvent) bool {
-	return ev.Meta.GetName() == n.NodeName
-}
-
-func (n *NodeControllerConfig) Update(ev event.UpdateEvent) bool {
-	return ev.MetaOld.GetName() == n.NodeName
-}
-
-func (n *NodeControllerConfig) Generic(ev event.GenericEvent) bool {
-	return ev.Meta.GetName() == n.NodeName
+	StatusInterval time.Duration
+	BackoffBase    time.Duration
+	BackoffMax     time.Duration
+	// generate missing private key file and publish its public key into my CR
+	GeneratePrivateKey bool
+	// rotate the key periodically, 0 disables it
+	KeyRotationInterval time.Duration
+	// switch over to the pending key after this long even if not all peers acknowledged it
+	KeyRotationTimeout time.Duration
+	// interfaces to manage, derived from my CRs and their networks when empty
+	Interfaces []InterfaceConfig
+	// records the interfaces created by the agent, so they're removed once no longer configured. Empty disables removal
+	StateFile string
+	// re-resolve endpoint hostnames at least this often, even if their DNS TTL is longer
+	EndpointMaxTTL time.Duration
+	// pick the IPv6 address of endpoint hostnames resolving to both families, e.g. on IPv6 only hosts
+	PreferIPv6Endpoints bool
+	// port serving /healthz and /readyz, 0 disables them
+	HealthPort int
+	// report unhealthy once a loop hasn't gone around for this long on top of StatusInterval
+	StuckTimeout time.Duration
+	// report unready once syncs keep failing for this long
+	UnreadyTimeout time.Duration
+	// compare the interfaces to the applied config this often and correct drift, 0 disables the check
+	DriftCheckInterval time.Duration
+	// only report drift, leave it to the next sync to correct it
+	DriftReportOnly bool
+	// applies the configs to the interfaces and reads their state
+	Backend backend.Backend
+	// leave the interfaces up when my CR is deleted, only let it go
+	KeepInterfaces bool
 }
 
 type nodeController struct {
@@ -68,55 +90,190 @@ type nodeController struct {
 	scheme *runtime.Scheme
 	update chan bool
 	dirty  bool
-}
 
-var _ manager.Runnable = (*nodeController)(nil)
-var _ reconcile.Reconciler = (*nodeController)(nil)
+	// peer CR names by public key and interfaces touched in the last successful sync, used for status reporting.
+	// interfaces are read by the agent as well, guarded by mu
+	peerNames  map[wgtypes.Key]string
+	mu         sync.Mutex
+	interfaces []string
+	// pending keys of peers applied in the last successful sync
+	acknowledgedKeys []string
+	// when my key rotation has to move forward on time rather than on CR changes, zero if it doesn't
+	nextRotation time.Time
+	// when a staged preshared key of the last successful sync takes effect, zero if none is staged
+	nextPSKSwitch time.Time
+
+	// peer endpoint hostnames, and the peers of the last successful sync using them
+	resolver      *endpointResolver
+	endpointPeers []endpointPeer
+
+	// Nodes watched by the agent, and my endpoint derived in the last successful sync if my spec has endpointFrom
+	nodes    cache.Store
+	endpoint string
+
+	// whether my firewall tables may exist on the interface
+	firewallInstalled bool
+
+	// outcome of the last sync, reported as status conditions
+	lastSyncErr        error
+	observedGeneration int64
+	everSynced         bool
+	// the same, served on the health endpoints
+	health healthState
+
+	// events are recorded on my own CR as fetched in the last sync, along with the peer changes it applied
+	events  *eventEmitter
+	self    runtime.Object
+	changes peerChanges
+
+	// configs applied to the interfaces in the last successful sync, checked for drift
+	applied map[string]wgquick.Config
+	// whether the interfaces were taken down since my CR is being deleted
+	tornDown bool
+}
 
-func (r *nodeController) Reconcile(request reconcile.Request) (reconcile.Result, error) {
-	logrus.WithField("name", request.Name).WithField("namespace", request.Namespace).Infoln("update triggered")
-	r.update <- true
-	return reconcile.Result{}, nil
+// appliedInterfaces returns the interfaces configured in the last successful sync
+func (r *nodeController) appliedInterfaces() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interfaces
 }
 
+// coalesceWindow is the time window in which update events are merged into a single sync
+const coalesceWindow = 200 * time.Millisecond
+
 func (ctl *nodeController) Start(done <-chan struct{}) error {
-	log := logrus.WithContext(context.Background())
-	// retry on error
-	// TODO: Added exponential backoff
-	// TODO: extract these times to constants
+	log := logrus.WithField("iface", ctl.Interface)
+	bo := newBackoff(ctl.BackoffBase, ctl.BackoffMax)
+
+	// re-resolve endpoint hostnames as they expire. resolve channel is nil while there are none
+	var resolve <-chan time.Time
+	scheduleResolve := func() {
+		resolve = nil
+		if t, ok := ctl.resolver.next(); ok {
+			resolve = time.After(time.Until(t))
+		}
+	}
+
+	// move key rotation forward once it's due, and switch to staged preshared keys once they take effect.
+	// rotate channel is nil while neither is waiting on time
+	var rotate <-chan time.Time
+	scheduleRotation := func() {
+		rotate = nil
+		next := ctl.nextRotation
+		if next.IsZero() || !ctl.nextPSKSwitch.IsZero() && ctl.nextPSKSwitch.Before(next) {
+			next = ctl.nextPSKSwitch
+		}
+		if !next.IsZero() {
+			rotate = time.After(time.Until(next))
+		}
+	}
+
+	// retry on error with exponential backoff. retry channel is nil while we're not backing off
+	var retry <-chan time.Time
 	sync := func() {
+		defer scheduleResolve()
+		defer scheduleRotation()
+		start := time.Now()
 		err := ctl.sync()
+		syncDuration.WithLabelValues(ctl.Interface).Observe(time.Since(start).Seconds())
+		ctl.health.synced(time.Now(), err)
+		ctl.recordSync(err)
+		ctl.recordResolveFailures()
+		ctl.lastSyncErr = err
 		switch err {
 		case nil:
 			ctl.dirty = false
+			syncDirty.WithLabelValues(ctl.Interface).Set(0)
+			ctl.everSynced = true
+			retry = nil
+			bo.Reset()
+			syncFailures.WithLabelValues(ctl.Interface).Set(0)
+			syncBackoff.WithLabelValues(ctl.Interface).Set(0)
+			syncNextRetry.WithLabelValues(ctl.Interface).Set(0)
 			log.Infoln("successfully synced config")
 		default:
 			ctl.dirty = true
-			log.WithError(err).Errorln("error during syncing")
+			syncDirty.WithLabelValues(ctl.Interface).Set(1)
+			syncErrors.WithLabelValues(ctl.Interface, reasonOf(err)).Inc()
+			delay := bo.Next()
+			next := time.Now().Add(delay)
+			retry = time.After(delay)
+			syncFailures.WithLabelValues(ctl.Interface).Set(float64(bo.Failures()))
+			syncBackoff.WithLabelValues(ctl.Interface).Set(delay.Seconds())
+			syncNextRetry.WithLabelValues(ctl.Interface).Set(float64(next.Unix()))
+			log.WithError(err).
+				WithField("failures", bo.Failures()).
+				WithField("backoff", delay).
+				WithField("next_retry", next.Format(time.RFC3339)).
+				Errorln("error during syncing")
 		}
 	}
 
-	t := time.NewTicker(5 * time.Second)
+	updateStatus := func() {
+		if err := ctl.updateStatus(context.Background(), log); err != nil {
+			log.WithError(err).Warnln("cannot update status")
+		}
+	}
+
+	// check for drift periodically. drift channel is nil if disabled
+	var drift <-chan time.Time
+	if ctl.DriftCheckInterval > 0 && !ctl.DryRun {
+		dt := time.NewTicker(ctl.DriftCheckInterval)
+		defer dt.Stop()
+		drift = dt.C
+	}
+
+	st := time.NewTicker(ctl.StatusInterval)
+	defer st.Stop()
 	for {
+		ctl.health.beat(time.Now())
 		select {
-		case <-t.C:
-			if ctl.dirty {
+		case <-retry:
+			sync()
+			updateStatus()
+		case <-resolve:
+			resync, err := ctl.refreshEndpoints(log)
+			if err != nil {
+				log.WithError(err).Warnln("cannot update peer endpoints, syncing instead")
+			}
+			// while dirty, the pending retry syncs anyway
+			if (err != nil || resync) && !ctl.dirty {
+				sync()
+			}
+			ctl.recordResolveFailures()
+			scheduleResolve()
+			updateStatus()
+		case <-rotate:
+			if !ctl.dirty {
 				sync()
+				updateStatus()
+			}
+		case <-st.C:
+			updateStatus()
+		case <-drift:
+			// while dirty, the retries correct drift anyway
+			if !ctl.dirty && ctl.checkDrift(log) {
+				log.Infoln("correcting drift")
+				sync()
+				updateStatus()
 			}
 		case <-done:
 			return nil
 		case <-ctl.update:
 			// coalesce update interrupts
-			coalesce := time.After(200 * time.Millisecond)
+			coalesce := time.After(coalesceWindow)
 		outer:
 			for {
 				select {
 				case <-ctl.update:
+					coalescedUpdates.WithLabelValues(ctl.Interface).Inc()
 				case <-coalesce:
 					break outer
 				}
 			}
 			sync()
+			updateStatus()
 		}
 	}
 }
@@ -126,68 +283,120 @@ func (r *nodeController) fetchMyself(ctx context.Context) (wgv1alpha1.VPNNode, e
 	case Server:
 		srvme := &wgv1alpha1.Server{}
 		if err := r.client.Get(ctx, client.ObjectKey{Name: r.NodeName, Namespace: r.Namespace}, srvme); err != nil {
-			return nil, errors.New("cannot find myself -- server")
+			return nil, withReason(ReasonNotFound, errors.Wrap(err, "cannot find myself -- server"))
 		}
 		return srvme, nil
 	case Client:
 		clientMe := &wgv1alpha1.Client{}
 		if err := r.client.Get(ctx, client.ObjectKey{Name: r.NodeName, Namespace: r.Namespace}, clientMe); err != nil {
-			return nil, errors.New("cannot find myself -- client")
+			return nil, withReason(ReasonNotFound, errors.Wrap(err, "cannot find myself -- client"))
 		}
 		return clientMe, nil
+	case Auto:
+		key := client.ObjectKey{Name: r.NodeName, Namespace: r.Namespace}
+		srvme, clientMe := &wgv1alpha1.Server{}, &wgv1alpha1.Client{}
+		srvErr := r.client.Get(ctx, key, srvme)
+		clientErr := r.client.Get(ctx, key, clientMe)
+		switch {
+		case srvErr == nil && clientErr == nil:
+			return nil, reasonf(ReasonInvalidInterfaceConfig, "both a server and a client are named %s, set the interface's mode", r.NodeName)
+		case srvErr == nil:
+			return srvme, nil
+		case clientErr == nil:
+			return clientMe, nil
+		default:
+			return nil, withReason(ReasonNotFound, errors.Wrap(clientErr, "cannot find myself -- neither server nor client"))
+		}
 	default:
-		return nil, errors.New("invalid mode type!")
+		return nil, reasonf(ReasonInvalidInterfaceConfig, "invalid mode type!")
 	}
 }
 
-func (r *nodeController) syncConfig(ctx context.Context, cfg *wgquick.Config, iface string, log logrus.FieldLogger) error {
+// syncConfig applies the config to the interface and returns how it changed the peers
+func (r *nodeController) syncConfig(ctx context.Context, cfg *wgquick.Config, iface string, log logrus.FieldLogger) (peerChanges, error) {
 	log = log.WithField("iface", iface)
 	pub := cfg.PrivateKey.PublicKey()
 	log.Info("read private key", "public key", base64.StdEncoding.EncodeToString(pub[:]))
 
-	// set dummy key and log the config with fake private key
-	privKey := cfg.PrivateKey
+	// log the config with fake private and preshared keys
 	dummyKey := wgtypes.Key([32]byte{0})
-	cfg.PrivateKey = &dummyKey
-	log.Infof("about to apply config:\n%s", cfg.String())
-	cfg.PrivateKey = privKey
+	logCfg := *cfg
+	logCfg.PrivateKey = &dummyKey
+	logCfg.Peers = make([]wgtypes.PeerConfig, len(cfg.Peers))
+	for i, peer := range cfg.Peers {
+		if peer.PresharedKey != nil {
+			peer.PresharedKey = &dummyKey
+		}
+		logCfg.Peers[i] = peer
+	}
+	log.Infof("about to apply config:\n%s", logCfg.String())
 	if r.DryRun {
 		log.Info("Dry run, not applying config!")
-		return nil
+		return peerChanges{}, nil
 	}
-	if err := wgquick.Sync(cfg, iface, log); err != nil {
-		return err
+	changes, err := devicePeerChanges(r.Backend, iface, cfg.Peers)
+	if err != nil {
+		log.WithError(err).Warnln("cannot compare peers to the device, the changes won't be reported")
+	}
+	if err := r.Backend.Sync(cfg, iface, log); err != nil {
+		return peerChanges{}, withReason(ReasonApplyFailed, err)
 	}
 	if r.SyncConfig {
 		m, err := cfg.MarshalText()
 		if err != nil {
-			return fmt.Errorf("cannot marshal config: %v", err)
+			return peerChanges{}, reasonf(ReasonWriteConfigFailed, "cannot marshal config: %v", err)
 		}
 		pp := path.Join(r.SyncConfigPath, iface+".conf")
 		if err := ioutil.WriteFile(pp, m, 0600); err != nil {
-			return fmt.Errorf("cannot write config to %s: %v", pp, err)
+			return peerChanges{}, reasonf(ReasonWriteConfigFailed, "cannot write config to %s: %v", pp, err)
 		}
 		log.Infoln("Synced config to disk")
 	}
-	return nil
+	return changes, nil
 }
 
-func (r *nodeController) allClientPeerConfig(ctx context.Context, me wgv1alpha1.VPNNode, log logrus.FieldLogger) ([]wgtypes.PeerConfig, error) {
+func (r *nodeController) allClientPeerConfig(ctx context.Context, me wgv1alpha1.VPNNode, ps *peerSet, psks *pskResolver, log logrus.FieldLogger) ([]wgtypes.PeerConfig, error) {
+	srv := me.(*wgv1alpha1.Server)
+	opts, err := r.listOptions(srv.Spec.ClientSelector)
+	if err != nil {
+		return nil, err
+	}
 	clients := &wgv1alpha1.ClientList{}
-	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, clients); err != nil {
-		log.Error(err, "cannot list all client")
+	if err := r.client.List(ctx, opts, clients); err != nil {
+		return nil, reasonf(ReasonListFailed, "cannot list all clients: %v", err)
 	}
 
 	peers := make([]wgtypes.PeerConfig, 0, len(clients.Items))
-	for _, cl := range clients.Items {
-		if cl.Name == (me).(*wgv1alpha1.Server).Name {
+	for i := range clients.Items {
+		cl := &clients.Items[i]
+		if cl.Name == srv.Name || terminating(cl) {
+			continue
+		}
+		// the client has to select me as well
+		if ok, err := wgv1alpha1.Peers(srv, cl); err != nil || !ok {
+			if err != nil {
+				log.WithError(err).WithField("client", cl.Name).Warnln("skipping client with invalid selector")
+			}
+			continue
+		}
+		if cl.Spec.PublicKey == "" {
+			log.WithField("client", cl.Name).Warnln("skipping client without public key")
 			continue
 		}
-		peer, err := cl.ToPeerConfig()
+		psk, err := psks.lookup(ctx, srv, cl.Name)
 		if err != nil {
-			return nil, fmt.Errorf("cannot generate peer config for client %s: %v", cl.Name, err)
+			log.WithError(err).WithField("client", cl.Name).Warnln("skipping client without preshared key")
+			continue
+		}
+		clPeers, err := ps.add(cl)
+		if err == errUnresolved {
+			log.WithField("client", cl.Name).Warnln("skipping client whose endpoint hasn't resolved yet")
+			continue
+		} else if err != nil {
+			return nil, reasonf(ReasonInvalidPeerConfig, "cannot generate peer config for client %s: %v", cl.Name, err)
 		}
-		peers = append(peers, peer)
+		setPresharedKey(clPeers, psk)
+		peers = append(peers, clPeers...)
 	}
 	return peers, nil
 }
@@ -198,97 +407,296 @@ func (r *nodeController) sync() error {
 
 	me, err := r.fetchMyself(ctx)
 	if err != nil {
+		// once my CR is gone there's nothing left to do until it's recreated
+		if r.tornDown && reasonOf(err) == ReasonNotFound {
+			return nil
+		}
 		return err
 	}
+	r.self = me
+	r.observedGeneration = me.GetGeneration()
+	if me.GetDeletionTimestamp() != nil {
+		return r.teardown(ctx, me, log)
+	}
+	r.tornDown = false
+	if err := r.addFinalizer(ctx, me, log); err != nil {
+		return err
+	}
+	network, err := fetchNetwork(ctx, r.client, r.Namespace, me)
+	if err != nil {
+		return err
+	}
+	iface := r.Interface
+
+	if err := r.reconcileKey(ctx, me, log); err != nil {
+		return err
+	}
+	if pool := addressPool(me, network); len(me.GetCommonSpec().Addresses) == 0 && pool != "" {
+		return reasonf(ReasonAddressPending, "waiting for an address from pool %s", pool)
+	}
 
 	cfg, err := me.ToInterfaceConfig(r.PrivateKeyFile)
 	if err != nil {
-		return fmt.Errorf("cannot create interface config: %v", err)
+		return reasonf(ReasonInvalidInterfaceConfig, "cannot create interface config: %v", err)
+	}
+	if err := applyNetwork(cfg, me, network); err != nil {
+		return reasonf(ReasonInvalidInterfaceConfig, "cannot apply network %s: %v", network.Name, err)
+	}
+	endpoint := ""
+	if s, ok := me.(*wgv1alpha1.Server); ok && s.Spec.EndpointFrom != nil {
+		var listenPort int
+		if endpoint, listenPort, err = r.endpointFrom(ctx, s); err != nil {
+			return withReason(ReasonEndpointUnavailable, err)
+		}
+		cfg.ListenPort = &listenPort
 	}
 	cfg.Table = r.RouteTable
 	cfg.RouteProtocol = r.RouteProto
 	cfg.RouteMetric = r.RouteMetric
 
-	if r.Mode == Server {
-		cfg.Peers, err = r.allClientPeerConfig(ctx, me, log)
+	psks, err := r.newPSKResolver(ctx)
+	if err != nil {
+		return err
+	}
+	r.resolver.begin()
+	ps := newPeerSet(r.resolver.resolve)
+	var interfaces []string
+	var endpointPeers []endpointPeer
+	var changes peerChanges
+	applied := make(map[string]wgquick.Config)
+	myClient, isClient := me.(*wgv1alpha1.Client)
+	if !isClient {
+		cfg.Peers, err = r.allClientPeerConfig(ctx, me, ps, psks, log)
 		if err != nil {
 			return err
 		}
+		// clients reach out to me, so by default I don't send keepalives to them
+		if d, ok := keepalive(me, network); ok {
+			setKeepalive(cfg.Peers, d)
+		}
 	}
 
+	// servers peer with every other server, clients only with servers they select and are selected by
+	opts := &client.ListOptions{Namespace: r.Namespace}
+	if isClient {
+		if opts, err = r.listOptions(myClient.Spec.ServerSelector); err != nil {
+			return err
+		}
+	}
 	servers := &wgv1alpha1.ServerList{}
-	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, servers); err != nil {
-		log.Error(err, "cannot list all servers")
-		return err
+	if err := r.client.List(ctx, opts, servers); err != nil {
+		return reasonf(ReasonListFailed, "cannot list all servers: %v", err)
 	}
 
-	for _, srv := range servers.Items {
-		if srv.Name == me.NodeName() {
+	for i := range servers.Items {
+		srv := &servers.Items[i]
+		if srv.Name == me.NodeName() || terminating(srv) || !wgv1alpha1.SameNetwork(srv, me) {
 			continue
 		}
-		peer, err := srv.ToPeerConfig()
+		if isClient {
+			if ok, err := wgv1alpha1.Peers(srv, myClient); err != nil || !ok {
+				if err != nil {
+					log.WithError(err).WithField("server", srv.Name).Warnln("skipping server with invalid selector")
+				}
+				continue
+			}
+		}
+		if srv.Spec.PublicKey == "" {
+			log.WithField("server", srv.Name).Warnln("skipping server without public key")
+			continue
+		}
+		var psk *wgtypes.Key
+		if myServer, ok := me.(*wgv1alpha1.Server); ok && wgv1alpha1.OwnsPresharedKey(myServer.Name, srv.Name) {
+			psk, err = psks.lookup(ctx, myServer, srv.Name)
+		} else {
+			psk, err = psks.lookup(ctx, srv, me.NodeName())
+		}
 		if err != nil {
-			return fmt.Errorf("cannot generate peer config for server %s: %v", srv.Name, err)
+			log.WithError(err).WithField("server", srv.Name).Warnln("skipping server without preshared key")
+			continue
+		}
+		srvPeers, err := ps.add(srv)
+		if err == errUnresolved {
+			log.WithField("server", srv.Name).Warnln("skipping server whose endpoint hasn't resolved yet")
+			continue
+		} else if err != nil {
+			return reasonf(ReasonInvalidPeerConfig, "cannot generate peer config for server %s: %v", srv.Name, err)
 		}
-		cfg.Peers = append(cfg.Peers, peer)
+		setPresharedKey(srvPeers, psk)
+		if d, ok := keepalive(me, network); ok {
+			setKeepalive(srvPeers, d)
+		}
+		cfg.Peers = append(cfg.Peers, srvPeers...)
 
 		// TODO: refactor this, it's kinda uglish
 		if r.SplitServers {
-			if r.Mode != Client {
-				return fmt.Errorf("split-servers only supported in client mode")
+			if !isClient {
+				return reasonf(ReasonInvalidInterfaceConfig, "split-servers only supported in client mode")
 			}
 			c := cfg
 			oldPeers := c.Peers
-			c.Peers = []wgtypes.PeerConfig{peer}
+			c.Peers = srvPeers
 			c.ListenPort = nil
-			if err := r.syncConfig(ctx, c, r.Interface+"-"+srv.Name, log); err != nil {
-				return fmt.Errorf("cannot sync server %s: %v", srv.Name, err)
+			ch, err := r.syncConfig(ctx, c, iface+"-"+srv.Name, log)
+			if err != nil {
+				return withReason(reasonOf(err), fmt.Errorf("cannot sync server %s: %v", srv.Name, err))
 			}
+			changes.merge(ch)
+			applied[iface+"-"+srv.Name] = *c
+			interfaces = append(interfaces, iface+"-"+srv.Name)
+			endpointPeers = append(endpointPeers, ps.endpointPeers(iface+"-"+srv.Name, srvPeers)...)
 			c.Peers = oldPeers
 		}
 	}
 
+	if isClient && myClient.Meshes(network) {
+		meshPeers, err := r.meshPeerConfig(ctx, myClient, network, ps, log)
+		if err != nil {
+			return err
+		}
+		cfg.Peers = append(cfg.Peers, meshPeers...)
+	}
+
 	// No need for generic interface, we're split all client -> server iface over separate interfaces
-	if r.SplitServers && r.Mode == Client {
-		return nil
+	if !(r.SplitServers && isClient) {
+		rules, restricted, err := r.firewallRules(ctx, me, iface, ps.nodes, log)
+		if err != nil {
+			return err
+		}
+		// the rules go first, so isolated peers are never reachable unrestricted. If they can't be applied
+		// the other peers are still synced, the isolated ones left out until a retry succeeds
+		fwErr := r.syncFirewall(rules, log)
+		if fwErr != nil && len(restricted) > 0 {
+			log.WithError(fwErr).WithField("peers", len(restricted)).Warnln("leaving out isolated peers")
+			cfg.Peers = withoutRestricted(cfg.Peers, ps.names, restricted)
+		}
+		ch, err := r.syncConfig(ctx, cfg, iface, log)
+		if err != nil {
+			return err
+		}
+		changes.merge(ch)
+		applied[iface] = *cfg
+		if fwErr != nil {
+			return fwErr
+		}
+		interfaces = append(interfaces, iface)
+		endpointPeers = append(endpointPeers, ps.endpointPeers(iface, cfg.Peers)...)
 	}
+	r.mu.Lock()
+	r.interfaces = interfaces
+	r.mu.Unlock()
+	r.peerNames, r.acknowledgedKeys = ps.names, ps.pendingKeys
+	r.endpointPeers = endpointPeers
+	r.resolver.end()
+	r.endpoint = endpoint
+	r.changes = changes
+	r.applied = applied
+	r.nextPSKSwitch = psks.next
+
+	if err := r.advanceRotation(ctx, me, ps.nodes, log); err != nil {
+		return reasonf(ReasonKeyRotationFailed, "key rotation failed: %v", err)
+	}
+	r.nextRotation = r.nextRotationStep(me)
+	return nil
+}
 
-	return r.syncConfig(ctx, cfg, r.Interface, log)
+// mayServe reports whether any interface may be configured from a Server CR
+func mayServe(config NodeControllerConfig) bool {
+	if len(config.Interfaces) == 0 {
+		return config.Mode != Client
+	}
+	for _, ic := range config.Interfaces {
+		if ic.Mode != Client {
+			return true
+		}
+	}
+	return false
 }
 
-// Add creates a new Client Controller and adds it to the Manager. The Manager will set fields on the Controller
-// and Start it when the Manager is Started.
+// Add creates the node agent and adds it to the Manager. The agent runs a controller for each interface it
+// manages, sharing the Manager's informers
 func Add(mgr manager.Manager, config NodeControllerConfig) error {
-	r := &nodeController{
+	switch config.Mode {
+	case Client, Server, Auto:
+	default:
+		return fmt.Errorf("unknown mode %d", config.Mode)
+	}
+	for _, ic := range config.Interfaces {
+		if ic.Mode != Client && ic.Mode != Server && ic.Mode != Auto {
+			return fmt.Errorf("unknown mode %d of interface %s", ic.Mode, ic.Name)
+		}
+	}
+	if config.Backend == nil {
+		config.Backend = &backend.Kernel{}
+	}
+
+	a := &agent{
 		client:               mgr.GetClient(),
 		scheme:               mgr.GetScheme(),
-		update:               make(chan bool, 100),
+		update:               make(chan bool, 1),
+		workers:              make(map[string]*worker),
+		recorder:             mgr.GetRecorder("wg-operator"),
 		NodeControllerConfig: config,
 	}
 
-	if err := mgr.Add(r); err != nil {
+	if err := mgr.Add(a); err != nil {
 		return err
 	}
+	if config.HealthPort != 0 {
+		if err := mgr.Add(&healthServer{agent: a, addr: fmt.Sprintf(":%d", config.HealthPort)}); err != nil {
+			return err
+		}
+	}
 
 	// Create a new controller
-	c, err := controller.New("server-controller", mgr, controller.Options{Reconciler: r})
+	c, err := controller.New("node-controller", mgr, controller.Options{Reconciler: a})
 	if err != nil {
 		return err
 	}
 
-	switch config.Mode {
-	case Client:
-		err = c.Watch(&source.Kind{Type: &wgv1alpha1.Client{}}, &handler.EnqueueRequestForObject{}, &config)
-	case Server:
-		err = c.Watch(&source.Kind{Type: &wgv1alpha1.Client{}}, &handler.EnqueueRequestForObject{})
-	default:
-		return fmt.Errorf("unknown mode %d", config.Mode)
+	err = c.Watch(&source.Kind{Type: &wgv1alpha1.Client{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+	if err != nil {
+		return err
 	}
 
-	err = c.Watch(&source.Kind{Type: &wgv1alpha1.Server{}}, &handler.EnqueueRequestForObject{})
+	err = c.Watch(&source.Kind{Type: &wgv1alpha1.Server{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
 	if err != nil {
 		return err
 	}
 
+	err = c.Watch(&source.Kind{Type: &wgv1alpha1.Network{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &wgv1alpha1.PeerPolicy{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+	if err != nil {
+		return err
+	}
+
+	// preshared keys
+	err = c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+	if err != nil {
+		return err
+	}
+
+	// server endpoints derived from services and nodes
+	if mayServe(config) {
+		cs, err := kubernetes.NewForConfig(mgr.GetConfig())
+		if err != nil {
+			return err
+		}
+		lw := cache.NewListWatchFromClient(cs.CoreV1().RESTClient(), "nodes", metav1.NamespaceAll, fields.Everything())
+		a.nodes = cache.NewSharedIndexInformer(lw, &corev1.Node{}, 0, cache.Indexers{})
+		err = c.Watch(&source.Informer{Informer: a.nodes}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+		if err != nil {
+			return err
+		}
+		err = c.Watch(&source.Kind{Type: &corev1.Service{}}, &handler.EnqueueRequestForObject{}, &peerFilter{a})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
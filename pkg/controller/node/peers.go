@@ -0,0 +1,85 @@
+package node
+
+import (
+	"errors"
+	"net"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+)
+
+// peerSet accumulates the peers of this node during sync
+type peerSet struct {
+	resolve wgv1alpha1.Resolver
+	// peer CR names by public key
+	names map[wgtypes.Key]string
+	// endpoints of peers given by hostname, by public key
+	hostnames map[wgtypes.Key]string
+	nodes     []wgv1alpha1.VPNNode
+	// pending keys of peers, acknowledged once the config is applied
+	pendingKeys []string
+}
+
+func newPeerSet(resolve wgv1alpha1.Resolver) *peerSet {
+	return &peerSet{
+		resolve:   resolve,
+		names:     make(map[wgtypes.Key]string),
+		hostnames: make(map[wgtypes.Key]string),
+	}
+}
+
+// errUnresolved is returned for a node whose endpoint hostname has never been resolved. Such a peer is left
+// out rather than configured without an endpoint
+var errUnresolved = errors.New("endpoint hasn't been resolved yet")
+
+// add generates peer configs for the node, one per its public key
+func (ps *peerSet) add(node wgv1alpha1.VPNNode) ([]wgtypes.PeerConfig, error) {
+	peers, err := node.ToPeerConfigs(ps.resolve)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := endpointOf(node)
+	host, _, _ := net.SplitHostPort(endpoint)
+	if len(peers) > 0 && endpoint != "" && peers[0].Endpoint == nil {
+		return nil, errUnresolved
+	}
+	for _, peer := range peers {
+		ps.names[peer.PublicKey] = node.NodeName()
+		if host != "" && net.ParseIP(host) == nil {
+			ps.hostnames[peer.PublicKey] = endpoint
+		}
+	}
+	ps.nodes = append(ps.nodes, node)
+	if pending := node.GetCommonSpec().PendingPublicKey; pending != "" {
+		ps.pendingKeys = append(ps.pendingKeys, pending)
+	}
+	return peers, nil
+}
+
+// endpointPeer is a peer on one of my interfaces whose endpoint is given by hostname
+type endpointPeer struct {
+	iface    string
+	key      wgtypes.Key
+	endpoint string
+}
+
+// endpointPeers returns the peers configured on the interface whose endpoints are given by hostname
+func (ps *peerSet) endpointPeers(iface string, peers []wgtypes.PeerConfig) []endpointPeer {
+	var eps []endpointPeer
+	for _, peer := range peers {
+		if endpoint, ok := ps.hostnames[peer.PublicKey]; ok {
+			eps = append(eps, endpointPeer{iface: iface, key: peer.PublicKey, endpoint: endpoint})
+		}
+	}
+	return eps
+}
+
+func endpointOf(node wgv1alpha1.VPNNode) string {
+	switch n := node.(type) {
+	case *wgv1alpha1.Server:
+		return n.GetEndpoint()
+	case *wgv1alpha1.Client:
+		return n.Spec.Endpoint
+	}
+	return ""
+}
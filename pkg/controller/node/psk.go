@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// pskResolver finds preshared keys for server-peer pairs
+type pskResolver struct {
+	client    client.Client
+	namespace string
+	// per pair secrets, keyed by server and peer name
+	pairs map[[2]string]*corev1.Secret
+	// staged keys take effect once now passes their activation time. next is the earliest activation still
+	// ahead of the keys looked up, zero if there's none
+	now  time.Time
+	next time.Time
+}
+
+func (r *nodeController) newPSKResolver(ctx context.Context) (*pskResolver, error) {
+	req, err := labels.NewRequirement(wgv1alpha1.PSKServerLabel, selection.Exists, nil)
+	if err != nil {
+		return nil, err
+	}
+	secrets := &corev1.SecretList{}
+	opts := &client.ListOptions{Namespace: r.Namespace, LabelSelector: labels.NewSelector().Add(*req)}
+	if err := r.client.List(ctx, opts, secrets); err != nil {
+		return nil, reasonf(ReasonListFailed, "cannot list preshared key secrets: %v", err)
+	}
+	p := &pskResolver{
+		client:    r.client,
+		namespace: r.Namespace,
+		pairs:     make(map[[2]string]*corev1.Secret, len(secrets.Items)),
+		now:       time.Now(),
+	}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		p.pairs[[2]string{s.Labels[wgv1alpha1.PSKServerLabel], s.Labels[wgv1alpha1.PSKPeerLabel]}] = s
+	}
+	return p, nil
+}
+
+// usesSecret reports whether the secret may hold one of my preshared keys: a per pair secret of a pair I'm part
+// of, or a secret some server names in its presharedKey
+func (r *nodeController) usesSecret(ctx context.Context, me wgv1alpha1.VPNNode, s *corev1.Secret) bool {
+	if server, ok := s.Labels[wgv1alpha1.PSKServerLabel]; ok {
+		return server == me.NodeName() || s.Labels[wgv1alpha1.PSKPeerLabel] == me.NodeName()
+	}
+	servers := &wgv1alpha1.ServerList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, servers); err != nil {
+		return true
+	}
+	for _, srv := range servers.Items {
+		if spec := srv.Spec.PresharedKey; spec != nil && spec.SecretName == s.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns preshared key between the server and the peer, or nil if the server doesn't use them
+func (p *pskResolver) lookup(ctx context.Context, server *wgv1alpha1.Server, peer string) (*wgtypes.Key, error) {
+	spec := server.Spec.PresharedKey
+	if spec == nil {
+		return nil, nil
+	}
+	if s, ok := p.pairs[[2]string{server.Name, peer}]; ok {
+		return p.pairKey(s)
+	}
+	if spec.SecretName == "" {
+		if spec.PerPair {
+			return nil, fmt.Errorf("per pair preshared key secret for %s-%s doesn't exist yet", server.Name, peer)
+		}
+		return nil, nil
+	}
+	s := &corev1.Secret{}
+	if err := p.client.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: spec.SecretName}, s); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("preshared key secret %s not found", spec.SecretName)
+		}
+		return nil, err
+	}
+	key := spec.Key
+	if key == "" {
+		key = wgv1alpha1.PSKSecretKey
+	}
+	return parsePSK(s, key)
+}
+
+// pairKey returns the key of a per pair secret in effect now. Both sides of the pair switch over to a staged key
+// at its activation time, so the tunnel only breaks for as long as their clocks or syncs are apart
+func (p *pskResolver) pairKey(s *corev1.Secret) (*wgtypes.Key, error) {
+	if _, ok := s.Data[wgv1alpha1.PSKNextSecretKey]; ok {
+		activateAt, err := time.Parse(time.RFC3339, s.Annotations[wgv1alpha1.PSKActivateAtAnnotation])
+		switch {
+		case err != nil:
+		case !p.now.Before(activateAt):
+			return parsePSK(s, wgv1alpha1.PSKNextSecretKey)
+		case p.next.IsZero() || activateAt.Before(p.next):
+			p.next = activateAt
+		}
+	}
+	return parsePSK(s, wgv1alpha1.PSKSecretKey)
+}
+
+func parsePSK(s *corev1.Secret, key string) (*wgtypes.Key, error) {
+	data, ok := s.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no key %s", s.Name, key)
+	}
+	psk, err := wgquick.ParseKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse preshared key in secret %s: %v", s.Name, err)
+	}
+	return &psk, nil
+}
+
+func setPresharedKey(peers []wgtypes.PeerConfig, psk *wgtypes.Key) {
+	for i := range peers {
+		peers[i].PresharedKey = psk
+	}
+}
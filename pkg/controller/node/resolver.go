@@ -0,0 +1,224 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minResolveInterval bounds re-resolution of hostnames with short TTLs, and retries of failed lookups
+	minResolveInterval = 30 * time.Second
+	// resolveTimeout bounds a lookup, leaving each nameserver queryTimeout per query
+	resolveTimeout = 10 * time.Second
+)
+
+// endpointResolver caches the addresses of peer endpoint hostnames for their DNS TTL, capped at maxTTL.
+// A failed lookup keeps the last known address, so it only affects the peers using the hostname
+type endpointResolver struct {
+	maxTTL     time.Duration
+	preferIPv6 bool
+	lookup     func(ctx context.Context, host string) ([]net.IP, time.Duration, error)
+	now        func() time.Time
+	hosts      map[string]*hostEntry
+}
+
+type hostEntry struct {
+	ip      net.IP
+	expires time.Time
+	err     error
+	// used in the current or last sync
+	used bool
+}
+
+func newEndpointResolver(maxTTL time.Duration, preferIPv6 bool) *endpointResolver {
+	if maxTTL < minResolveInterval {
+		maxTTL = minResolveInterval
+	}
+	return &endpointResolver{
+		maxTTL:     maxTTL,
+		preferIPv6: preferIPv6,
+		lookup: func(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+			return lookupHost(ctx, host, maxTTL)
+		},
+		now:   time.Now,
+		hosts: make(map[string]*hostEntry),
+	}
+}
+
+// begin starts tracking the hostnames used in a sync
+func (er *endpointResolver) begin() {
+	for _, e := range er.hosts {
+		e.used = false
+	}
+}
+
+// end forgets hostnames which weren't used in the successful sync
+func (er *endpointResolver) end() {
+	for host, e := range er.hosts {
+		if !e.used {
+			delete(er.hosts, host)
+		}
+	}
+}
+
+// resolve resolves the endpoint from the cache, looking the hostname up if it expired. It returns a nil
+// address if the hostname has never been resolved, peers using it are left out until it is
+func (er *endpointResolver) resolve(endpoint string) (*net.UDPAddr, error) {
+	host, p, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port in endpoint %s", endpoint)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return &net.UDPAddr{IP: ip, Port: port}, nil
+	}
+
+	e, ok := er.hosts[host]
+	if !ok {
+		e = &hostEntry{}
+		er.hosts[host] = e
+	}
+	e.used = true
+	if !er.now().Before(e.expires) {
+		er.refresh(host, e)
+	}
+	if e.ip == nil {
+		return nil, nil
+	}
+	return &net.UDPAddr{IP: e.ip, Port: port}, nil
+}
+
+// refresh looks the hostname up and reports whether its address changed. The current address is kept as long
+// as the hostname still resolves to it, so round robin records don't flap
+func (er *endpointResolver) refresh(host string, e *hostEntry) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	ips, ttl, err := er.lookup(ctx, host)
+	now := er.now()
+	if err == nil && len(ips) == 0 {
+		err = fmt.Errorf("no addresses found for %s", host)
+	}
+	if err != nil {
+		e.err = err
+		e.expires = now.Add(minResolveInterval)
+		return false
+	}
+
+	e.err = nil
+	switch {
+	case ttl < minResolveInterval:
+		ttl = minResolveInterval
+	case ttl > er.maxTTL:
+		ttl = er.maxTTL
+	}
+	e.expires = now.Add(ttl)
+	for _, ip := range ips {
+		if ip.Equal(e.ip) {
+			return false
+		}
+	}
+	e.ip = pickAddress(ips, er.preferIPv6)
+	return true
+}
+
+// pickAddress picks the first address of the preferred family, IPv4 like net.ResolveUDPAddr does unless
+// preferIPv6 is set. Hostnames with addresses of a single family resolve to that family either way
+func pickAddress(ips []net.IP, preferIPv6 bool) net.IP {
+	for _, ip := range ips {
+		if (ip.To4() == nil) == preferIPv6 {
+			return ip
+		}
+	}
+	return ips[0]
+}
+
+// refreshExpired re-resolves expired hostnames and returns the ones whose address changed
+func (er *endpointResolver) refreshExpired() map[string]bool {
+	changed := make(map[string]bool)
+	now := er.now()
+	for host, e := range er.hosts {
+		if !now.Before(e.expires) && er.refresh(host, e) {
+			changed[host] = true
+		}
+	}
+	return changed
+}
+
+// next returns when the first hostname expires, ok is false if there are none
+func (er *endpointResolver) next() (t time.Time, ok bool) {
+	for _, e := range er.hosts {
+		if !ok || e.expires.Before(t) {
+			t, ok = e.expires, true
+		}
+	}
+	return t, ok
+}
+
+// resolveFailure describes a hostname whose last lookup failed
+type resolveFailure struct {
+	host    string
+	message string
+}
+
+// failures returns the hostnames whose last lookup failed, sorted by hostname
+func (er *endpointResolver) failures() []resolveFailure {
+	var out []resolveFailure
+	for host, e := range er.hosts {
+		switch {
+		case e.err == nil:
+		case e.ip != nil:
+			out = append(out, resolveFailure{host, fmt.Sprintf("%s: %v, using last known address %s", host, e.err, e.ip)})
+		default:
+			out = append(out, resolveFailure{host, fmt.Sprintf("%s: %v", host, e.err)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].host < out[j].host })
+	return out
+}
+
+// refreshEndpoints re-resolves expired hostnames and points only the peers using a changed one to its new
+// address, without a full sync. The config file on disk catches up on the next sync. Peers left out since
+// their hostname never resolved need a full sync once it does, which resync reports
+func (r *nodeController) refreshEndpoints(log logrus.FieldLogger) (resync bool, err error) {
+	changed := r.resolver.refreshExpired()
+	if len(changed) == 0 {
+		return false, nil
+	}
+
+	updates := make(map[string][]wgtypes.PeerConfig)
+	configured := make(map[string]bool)
+	for _, p := range r.endpointPeers {
+		host, _, _ := net.SplitHostPort(p.endpoint)
+		if !changed[host] {
+			continue
+		}
+		configured[host] = true
+		addr, err := r.resolver.resolve(p.endpoint)
+		if err != nil || addr == nil {
+			continue
+		}
+		log.WithField("iface", p.iface).WithField("endpoint", p.endpoint).Infof("peer endpoint moved to %s", addr)
+		updates[p.iface] = append(updates[p.iface], wgtypes.PeerConfig{PublicKey: p.key, UpdateOnly: true, Endpoint: addr})
+	}
+	resync = len(configured) < len(changed)
+	if r.DryRun || len(updates) == 0 {
+		return resync, nil
+	}
+
+	for iface, peers := range updates {
+		if err := r.Backend.ConfigureDevice(iface, wgtypes.Config{Peers: peers}); err != nil {
+			return resync, fmt.Errorf("cannot update peer endpoints on %s: %v", iface, err)
+		}
+	}
+	return resync, nil
+}
@@ -0,0 +1,108 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeDNS struct {
+	ips     []net.IP
+	ttl     time.Duration
+	err     error
+	lookups int
+}
+
+func (f *fakeDNS) lookup(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	f.lookups++
+	return f.ips, f.ttl, f.err
+}
+
+func TestEndpointResolver(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	dns := &fakeDNS{ips: []net.IP{net.ParseIP("fd00::1"), net.ParseIP("192.0.2.1")}, ttl: 10 * time.Second}
+	er := newEndpointResolver(5*time.Minute, false)
+	er.lookup = dns.lookup
+	er.now = func() time.Time { return now }
+
+	resolve := func(want string) {
+		t.Helper()
+		addr, err := er.resolve("vpn.example.com:51820")
+		if err != nil {
+			t.Fatalf("resolve() error = %v", err)
+		}
+		if got := addr.String(); got != want {
+			t.Fatalf("resolve() = %s, want %s", got, want)
+		}
+	}
+
+	resolve("192.0.2.1:51820")
+	if next, _ := er.next(); !next.Equal(now.Add(minResolveInterval)) {
+		t.Errorf("short TTL expires at %v, want it raised to %v", next, now.Add(minResolveInterval))
+	}
+	resolve("192.0.2.1:51820")
+	if dns.lookups != 1 {
+		t.Errorf("cached endpoint looked up %d times, want 1", dns.lookups)
+	}
+
+	// still among the answers, so the address sticks
+	now = now.Add(time.Minute)
+	dns.ips = []net.IP{net.ParseIP("192.0.2.2"), net.ParseIP("192.0.2.1")}
+	dns.ttl = time.Hour
+	if changed := er.refreshExpired(); len(changed) != 0 {
+		t.Errorf("refreshExpired() = %v, want no changes", changed)
+	}
+	if next, _ := er.next(); !next.Equal(now.Add(5 * time.Minute)) {
+		t.Errorf("long TTL expires at %v, want it capped to %v", next, now.Add(5*time.Minute))
+	}
+
+	now = now.Add(5 * time.Minute)
+	dns.ips = []net.IP{net.ParseIP("192.0.2.3")}
+	if changed := er.refreshExpired(); !changed["vpn.example.com"] {
+		t.Errorf("refreshExpired() = %v, want vpn.example.com changed", changed)
+	}
+	resolve("192.0.2.3:51820")
+
+	// failures keep the last known address and are reported
+	now = now.Add(5 * time.Minute)
+	dns.err = errors.New("server misbehaving")
+	er.refreshExpired()
+	resolve("192.0.2.3:51820")
+	if failures := er.failures(); len(failures) != 1 {
+		t.Errorf("failures() = %v, want one failure", failures)
+	}
+
+	// unused hostnames are forgotten after a sync
+	er.begin()
+	if _, err := er.resolve("192.0.2.9:51820"); err != nil {
+		t.Fatal(err)
+	}
+	er.end()
+	if _, ok := er.next(); ok {
+		t.Error("next() reports a hostname which is no longer used")
+	}
+}
+
+func TestPickAddress(t *testing.T) {
+	v4, v6 := net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")
+	tests := []struct {
+		name       string
+		ips        []net.IP
+		preferIPv6 bool
+		want       net.IP
+	}{
+		{"dual-stack prefers ipv4", []net.IP{v6, v4}, false, v4},
+		{"dual-stack prefers ipv6", []net.IP{v4, v6}, true, v6},
+		{"ipv6 only", []net.IP{v6}, false, v6},
+		{"ipv4 only", []net.IP{v4}, true, v4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pickAddress(tt.ips, tt.preferIPv6); !got.Equal(tt.want) {
+				t.Errorf("pickAddress() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Key rotation happens in three steps, each driven by sync:
+//
+//  1. a new key is generated into <private key file>.next and its public key is published as pendingPublicKey
+//  2. peers add the pending key alongside the current one and acknowledge it in their status.acknowledgedKeys
+//  3. once all peers acknowledged it (or KeyRotationTimeout passed) the node switches over. The pending key
+//     becomes publicKey, and peers retire the old key on their next sync
+//
+// The pending key has no allowed IPs until it's promoted, so traffic is only interrupted for the time it
+// takes peers to sync after the switch.
+
+func (r *nodeController) nextKeyFile() string {
+	return r.PrivateKeyFile + ".next"
+}
+
+// rotationDue returns why the rotation should start, or empty string if it shouldn't
+func (r *nodeController) rotationDue(me wgv1alpha1.VPNNode, now time.Time) string {
+	status := me.GetCommonStatus()
+	if trigger := me.GetAnnotations()[wgv1alpha1.RotateKeyAnnotation]; trigger != "" && trigger != status.KeyRotationTrigger {
+		return "annotation " + wgv1alpha1.RotateKeyAnnotation + "=" + trigger
+	}
+	if r.KeyRotationInterval <= 0 {
+		return ""
+	}
+	last := me.GetCreationTimestamp().Time
+	if status.LastKeyRotationTime != nil {
+		last = status.LastKeyRotationTime.Time
+	}
+	if now.Sub(last) >= r.KeyRotationInterval {
+		return fmt.Sprintf("key older than %v", r.KeyRotationInterval)
+	}
+	return ""
+}
+
+// nextRotationStep returns when the rotation has to move forward although no CR changed: when the key gets old
+// enough, or when the pending key stops waiting for peers. Zero if never
+func (r *nodeController) nextRotationStep(me wgv1alpha1.VPNNode) time.Time {
+	status := me.GetCommonStatus()
+	if me.GetCommonSpec().PendingPublicKey != "" {
+		if status.KeyRotationStartTime == nil {
+			return time.Time{}
+		}
+		return status.KeyRotationStartTime.Add(r.KeyRotationTimeout)
+	}
+	if r.KeyRotationInterval <= 0 {
+		return time.Time{}
+	}
+	last := me.GetCreationTimestamp().Time
+	if status.LastKeyRotationTime != nil {
+		last = status.LastKeyRotationTime.Time
+	}
+	return last.Add(r.KeyRotationInterval)
+}
+
+// startRotation generates the next key and publishes it as pending
+func (r *nodeController) startRotation(ctx context.Context, me wgv1alpha1.VPNNode, why string, log logrus.FieldLogger) error {
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		return fmt.Errorf("cannot generate private key: %v", err)
+	}
+	if err := writePrivateKey(r.nextKeyFile(), key); err != nil {
+		return err
+	}
+
+	trigger := me.GetAnnotations()[wgv1alpha1.RotateKeyAnnotation]
+	me.GetCommonSpec().PendingPublicKey = key.PublicKey().String()
+	if err := r.client.Update(ctx, me); err != nil {
+		return fmt.Errorf("cannot publish pending public key: %v", err)
+	}
+	now := metav1.Now()
+	status := me.GetCommonStatus()
+	status.KeyRotationTrigger = trigger
+	status.KeyRotationStartTime = &now
+	if err := r.client.Status().Update(ctx, me); err != nil {
+		return fmt.Errorf("cannot record key rotation start: %v", err)
+	}
+	log.WithField("reason", why).WithField("pending_public_key", key.PublicKey().String()).Infoln("started key rotation")
+	return nil
+}
+
+// finishRotation promotes the pending key. It's safe to call again if the previous attempt crashed midway
+func (r *nodeController) finishRotation(ctx context.Context, me wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	spec := me.GetCommonSpec()
+	if _, err := os.Stat(r.nextKeyFile()); err == nil {
+		if err := os.Rename(r.nextKeyFile(), r.PrivateKeyFile); err != nil {
+			return fmt.Errorf("cannot promote next private key: %v", err)
+		}
+	}
+
+	old := spec.PublicKey
+	spec.PublicKey = spec.PendingPublicKey
+	spec.PendingPublicKey = ""
+	if err := r.client.Update(ctx, me); err != nil {
+		return fmt.Errorf("cannot promote pending public key: %v", err)
+	}
+	now := metav1.Now()
+	status := me.GetCommonStatus()
+	status.KeyRotationStartTime = nil
+	status.LastKeyRotationTime = &now
+	if err := r.client.Status().Update(ctx, me); err != nil {
+		return fmt.Errorf("cannot record key rotation: %v", err)
+	}
+	log.WithField("old_public_key", old).WithField("public_key", spec.PublicKey).Infoln("switched over to the new key")
+	return nil
+}
+
+// abortRotation drops the pending key, e.g. when the next key file got lost
+func (r *nodeController) abortRotation(ctx context.Context, me wgv1alpha1.VPNNode, why string, log logrus.FieldLogger) error {
+	me.GetCommonSpec().PendingPublicKey = ""
+	if err := r.client.Update(ctx, me); err != nil {
+		return fmt.Errorf("cannot drop pending public key: %v", err)
+	}
+	log.WithField("reason", why).Warnln("aborted key rotation")
+	return nil
+}
+
+// advanceRotation moves the key rotation of this node forward. peers are all nodes this node is peering with.
+// It's called after the config has been applied, any change to my CR triggers another sync.
+func (r *nodeController) advanceRotation(ctx context.Context, me wgv1alpha1.VPNNode, peers []wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	spec := me.GetCommonSpec()
+	now := time.Now()
+	if spec.PendingPublicKey == "" {
+		if why := r.rotationDue(me, now); why != "" {
+			return r.startRotation(ctx, me, why, log)
+		}
+		return nil
+	}
+
+	current, err := readPrivateKey(r.PrivateKeyFile, false, log)
+	if err == nil && current.PublicKey().String() == spec.PendingPublicKey {
+		// switched the key file but crashed before publishing it
+		return r.finishRotation(ctx, me, log)
+	}
+	next, err := readPrivateKey(r.nextKeyFile(), false, log)
+	if err != nil {
+		return r.abortRotation(ctx, me, fmt.Sprintf("cannot read next private key: %v", err), log)
+	}
+	if next.PublicKey().String() != spec.PendingPublicKey {
+		return r.abortRotation(ctx, me, "next private key doesn't match pending public key", log)
+	}
+
+	var missing []string
+	for _, peer := range peers {
+		if !containsString(peer.GetCommonStatus().AcknowledgedKeys, spec.PendingPublicKey) {
+			missing = append(missing, peer.NodeName())
+		}
+	}
+	if len(missing) > 0 {
+		start := me.GetCommonStatus().KeyRotationStartTime
+		if start == nil || now.Sub(start.Time) < r.KeyRotationTimeout {
+			log.WithField("waiting_for", missing).Infoln("waiting for peers to acknowledge pending key")
+			return nil
+		}
+		log.WithField("missing", missing).Warnln("key rotation timed out, switching over without all acknowledgements")
+	}
+	return r.finishRotation(ctx, me, log)
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,39 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_nextRotationStep(t *testing.T) {
+	created := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+	rotated := metav1.NewTime(created.Add(48 * time.Hour))
+	started := metav1.NewTime(created.Add(time.Hour))
+	tests := []struct {
+		name     string
+		interval time.Duration
+		pending  string
+		status   wgv1alpha1.CommonStatus
+		want     time.Time
+	}{
+		{"no rotation", 0, "", wgv1alpha1.CommonStatus{}, time.Time{}},
+		{"never rotated", 24 * time.Hour, "", wgv1alpha1.CommonStatus{}, created.Add(24 * time.Hour)},
+		{"rotated", 24 * time.Hour, "", wgv1alpha1.CommonStatus{LastKeyRotationTime: &rotated}, rotated.Add(24 * time.Hour)},
+		{"pending", 0, "next", wgv1alpha1.CommonStatus{KeyRotationStartTime: &started}, started.Add(10 * time.Minute)},
+		{"pending without start", 24 * time.Hour, "next", wgv1alpha1.CommonStatus{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &nodeController{NodeControllerConfig: NodeControllerConfig{KeyRotationInterval: tt.interval, KeyRotationTimeout: 10 * time.Minute}}
+			me := &wgv1alpha1.Client{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)}}
+			me.Spec.PendingPublicKey = tt.pending
+			me.Status.CommonStatus = tt.status
+			if got := r.nextRotationStep(me); !got.Equal(tt.want) {
+				t.Errorf("nextRotationStep() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
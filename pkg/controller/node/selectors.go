@@ -0,0 +1,149 @@
+package node
+
+import (
+	"context"
+	"reflect"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// listOptions lists nodes in my namespace matching the selector, all of them if it's nil
+func (r *nodeController) listOptions(selector *metav1.LabelSelector) (*client.ListOptions, error) {
+	opts := &client.ListOptions{Namespace: r.Namespace}
+	if selector != nil {
+		sel, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return nil, reasonf(ReasonInvalidPeerConfig, "invalid selector: %v", err)
+		}
+		opts.LabelSelector = sel
+	}
+	return opts, nil
+}
+
+// peerFilter drops events of nodes and networks which don't affect the configuration of any of my interfaces
+// either before or after the change, so label, selector and network changes which add or remove a peer still
+// trigger a sync. My own CRs always pass, they may add or remove an interface
+type peerFilter struct {
+	a *agent
+}
+
+var _ predicate.Predicate = (*peerFilter)(nil)
+
+func (f *peerFilter) relevant(obj runtime.Object) bool {
+	if f.a.mine(obj) {
+		return true
+	}
+	for _, ctl := range f.a.controllers() {
+		if ctl.relevant(obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// relevant reports whether the object affects the configuration of my interface
+func (r *nodeController) relevant(obj runtime.Object) bool {
+	ctx := context.Background()
+	me, err := r.fetchMyself(ctx)
+	if err != nil {
+		return true
+	}
+	var peers bool
+	switch o := obj.(type) {
+	case *wgv1alpha1.Network:
+		return o.Name == me.GetCommonSpec().Network
+	case *wgv1alpha1.Client:
+		if o.Name == me.NodeName() {
+			return true
+		}
+		switch me := me.(type) {
+		case *wgv1alpha1.Server:
+			peers, err = wgv1alpha1.Peers(me, o)
+		case *wgv1alpha1.Client:
+			if !wgv1alpha1.SameNetwork(me, o) {
+				return false
+			}
+			network, err := fetchNetwork(ctx, r.client, r.Namespace, me)
+			return err != nil || (me.Meshes(network) && o.Meshes(network))
+		}
+	case *wgv1alpha1.Server:
+		if o.Name == me.NodeName() {
+			return true
+		}
+		switch me := me.(type) {
+		case *wgv1alpha1.Server:
+			peers = wgv1alpha1.SameNetwork(me, o)
+		case *wgv1alpha1.Client:
+			peers, err = wgv1alpha1.Peers(o, me)
+		}
+	case *wgv1alpha1.PeerPolicy:
+		_, ok := me.(*wgv1alpha1.Server)
+		return ok
+	case *corev1.Secret:
+		return r.usesSecret(ctx, me, o)
+	case *corev1.Service, *corev1.Node:
+		srv, ok := me.(*wgv1alpha1.Server)
+		return ok && derivesEndpointFrom(srv, obj)
+	default:
+		return true
+	}
+	return err != nil || peers
+}
+
+func (f *peerFilter) Create(ev event.CreateEvent) bool {
+	return f.relevant(ev.Object)
+}
+
+func (f *peerFilter) Delete(ev event.DeleteEvent) bool {
+	return f.relevant(ev.Object)
+}
+
+func (f *peerFilter) Update(ev event.UpdateEvent) bool {
+	// nodes report their status every few seconds, only their addresses matter
+	if old, ok := ev.ObjectOld.(*corev1.Node); ok {
+		if n, ok := ev.ObjectNew.(*corev1.Node); ok && reflect.DeepEqual(old.Status.Addresses, n.Status.Addresses) {
+			return false
+		}
+	}
+	// so do the agents of my peers, into their Servers and Clients
+	if statusOnly(ev.ObjectOld, ev.ObjectNew) {
+		return false
+	}
+	return f.relevant(ev.ObjectOld) || f.relevant(ev.ObjectNew)
+}
+
+// statusOnly reports whether the update of a Server or Client only changed status no configuration depends on,
+// like the peer state each agent reports every StatusInterval. Spec changes bump the generation, labels feed
+// selectors, annotations trigger key rotation and the deletion timestamp drops the node as a peer. Of the status,
+// key rotation waits on acknowledged keys and peers connect to a server's derived endpoint
+func statusOnly(oldObj, newObj runtime.Object) bool {
+	switch o := oldObj.(type) {
+	case *wgv1alpha1.Server:
+		n, ok := newObj.(*wgv1alpha1.Server)
+		if !ok || o.Status.Endpoint != n.Status.Endpoint {
+			return false
+		}
+	case *wgv1alpha1.Client:
+		if _, ok := newObj.(*wgv1alpha1.Client); !ok {
+			return false
+		}
+	default:
+		return false
+	}
+	o, n := oldObj.(wgv1alpha1.VPNNode), newObj.(wgv1alpha1.VPNNode)
+	return o.GetGeneration() == n.GetGeneration() &&
+		reflect.DeepEqual(o.GetLabels(), n.GetLabels()) &&
+		reflect.DeepEqual(o.GetAnnotations(), n.GetAnnotations()) &&
+		reflect.DeepEqual(o.GetDeletionTimestamp(), n.GetDeletionTimestamp()) &&
+		reflect.DeepEqual(o.GetCommonStatus().AcknowledgedKeys, n.GetCommonStatus().AcknowledgedKeys)
+}
+
+func (f *peerFilter) Generic(ev event.GenericEvent) bool {
+	return f.relevant(ev.Object)
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"testing"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func Test_statusOnly(t *testing.T) {
+	srv := func(change func(s *wgv1alpha1.Server)) *wgv1alpha1.Server {
+		s := &wgv1alpha1.Server{ObjectMeta: metav1.ObjectMeta{Name: "gateway", Generation: 1, Labels: map[string]string{"site": "a"}}}
+		change(s)
+		return s
+	}
+	cl := func(change func(c *wgv1alpha1.Client)) *wgv1alpha1.Client {
+		c := &wgv1alpha1.Client{ObjectMeta: metav1.ObjectMeta{Name: "laptop", Generation: 1}}
+		change(c)
+		return c
+	}
+	now := metav1.Now()
+	tests := []struct {
+		name     string
+		old, new runtime.Object
+		want     bool
+	}{
+		{"server peer state", srv(func(*wgv1alpha1.Server) {}), srv(func(s *wgv1alpha1.Server) {
+			s.Status.OnlinePeers, s.Status.LastUpdateTime = 3, &now
+		}), true},
+		{"client peer state", cl(func(*wgv1alpha1.Client) {}), cl(func(c *wgv1alpha1.Client) {
+			c.Status.Peers = []wgv1alpha1.PeerStatus{{Name: "gateway", Online: true}}
+		}), true},
+		{"finalizer", cl(func(*wgv1alpha1.Client) {}), cl(func(c *wgv1alpha1.Client) {
+			c.Finalizers = []string{wgv1alpha1.InterfaceFinalizer}
+		}), true},
+		{"spec", srv(func(*wgv1alpha1.Server) {}), srv(func(s *wgv1alpha1.Server) { s.Generation = 2 }), false},
+		{"labels", srv(func(*wgv1alpha1.Server) {}), srv(func(s *wgv1alpha1.Server) { s.Labels["site"] = "b" }), false},
+		{"rotate annotation", cl(func(*wgv1alpha1.Client) {}), cl(func(c *wgv1alpha1.Client) {
+			c.Annotations = map[string]string{wgv1alpha1.RotateKeyAnnotation: "1"}
+		}), false},
+		{"deleted", cl(func(*wgv1alpha1.Client) {}), cl(func(c *wgv1alpha1.Client) { c.DeletionTimestamp = &now }), false},
+		{"acknowledged keys", cl(func(*wgv1alpha1.Client) {}), cl(func(c *wgv1alpha1.Client) {
+			c.Status.AcknowledgedKeys = []string{"key"}
+		}), false},
+		{"derived endpoint", srv(func(*wgv1alpha1.Server) {}), srv(func(s *wgv1alpha1.Server) {
+			s.Status.Endpoint = "192.0.2.1:51820"
+		}), false},
+		{"network", &wgv1alpha1.Network{}, &wgv1alpha1.Network{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statusOnly(tt.old, tt.new); got != tt.want {
+				t.Errorf("statusOnly() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// peerOnlineTimeout is how recent the last handshake must be for the peer to count as online.
+// Wireguard rekeys active sessions every 2 minutes, so 3 minutes gives some slack.
+const peerOnlineTimeout = 3 * time.Minute
+
+func peerStatus(name string, peer wgtypes.Peer, now time.Time) wgv1alpha1.PeerStatus {
+	st := wgv1alpha1.PeerStatus{
+		Name:          name,
+		PublicKey:     peer.PublicKey.String(),
+		ReceiveBytes:  peer.ReceiveBytes,
+		TransmitBytes: peer.TransmitBytes,
+	}
+	if peer.Endpoint != nil {
+		st.Endpoint = peer.Endpoint.String()
+	}
+	if !peer.LastHandshakeTime.IsZero() {
+		t := metav1.NewTime(peer.LastHandshakeTime)
+		st.LastHandshakeTime = &t
+		st.Online = now.Sub(peer.LastHandshakeTime) < peerOnlineTimeout
+	}
+	return st
+}
+
+// updateStatus reads the live state of all managed interfaces and writes it, together with the outcome
+// of the last sync, into my own CR status
+func (r *nodeController) updateStatus(ctx context.Context, log logrus.FieldLogger) error {
+	// my CR is going away along with the interfaces
+	if r.tornDown {
+		return nil
+	}
+	me, err := r.fetchMyself(ctx)
+	if err != nil {
+		return err
+	}
+
+	status := me.GetCommonStatus()
+	deviceErr := r.readPeers(status, log)
+	if deviceErr != nil {
+		log.WithError(deviceErr).Warnln("cannot read device state")
+	}
+	r.setConditions(status, deviceErr)
+	if r.everSynced {
+		status.AcknowledgedKeys = r.acknowledgedKeys
+	}
+	if srv, ok := me.(*wgv1alpha1.Server); ok {
+		switch {
+		case srv.Spec.EndpointFrom == nil:
+			srv.Status.Endpoint = ""
+		case r.endpoint != "":
+			srv.Status.Endpoint = r.endpoint
+		}
+	}
+	t := metav1.Now()
+	status.LastUpdateTime = &t
+
+	return r.client.Status().Update(ctx, me)
+}
+
+// readPeers fills in the peer state from the wireguard devices. It leaves the status untouched if there's nothing to read
+func (r *nodeController) readPeers(status *wgv1alpha1.CommonStatus, log logrus.FieldLogger) error {
+	if r.DryRun || len(r.interfaces) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	var peers []wgv1alpha1.PeerStatus
+	online := 0
+	var lastHandshake *metav1.Time
+	for _, iface := range r.interfaces {
+		dev, err := r.Backend.Device(iface)
+		if err != nil {
+			return fmt.Errorf("cannot read device %s: %v", iface, err)
+		}
+		peerStats.set(iface, dev.Peers, r.peerNames)
+		for _, peer := range dev.Peers {
+			name, ok := r.peerNames[peer.PublicKey]
+			if !ok {
+				log.WithField("iface", iface).Warnf("unknown peer %s on the device", peer.PublicKey.String())
+			}
+			st := peerStatus(name, peer, now)
+			if st.Online {
+				online++
+			}
+			if st.LastHandshakeTime != nil && (lastHandshake == nil || lastHandshake.Before(st.LastHandshakeTime)) {
+				lastHandshake = st.LastHandshakeTime
+			}
+			peers = append(peers, st)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Name < peers[j].Name
+	})
+	status.Peers = peers
+	status.OnlinePeers = online
+	status.TotalPeers = len(peers)
+	status.LastHandshakeTime = lastHandshake
+	return nil
+}
+
+// setConditions derives Ready, Synced and Degraded from the last sync outcome and the device state
+func (r *nodeController) setConditions(status *wgv1alpha1.CommonStatus, deviceErr error) {
+	synced := wgv1alpha1.Condition{
+		Type:               wgv1alpha1.ConditionSynced,
+		Status:             corev1.ConditionTrue,
+		Reason:             ReasonSynced,
+		Message:            "configuration applied",
+		ObservedGeneration: r.observedGeneration,
+	}
+	degraded := wgv1alpha1.Condition{
+		Type:               wgv1alpha1.ConditionDegraded,
+		Status:             corev1.ConditionFalse,
+		Reason:             ReasonSynced,
+		ObservedGeneration: r.observedGeneration,
+	}
+	switch {
+	case r.lastSyncErr != nil:
+		synced.Status = corev1.ConditionFalse
+		synced.Reason = reasonOf(r.lastSyncErr)
+		synced.Message = r.lastSyncErr.Error()
+		if r.everSynced {
+			// previous configuration is still in place
+			degraded.Status = corev1.ConditionTrue
+			degraded.Reason = synced.Reason
+			degraded.Message = "running previous configuration: " + synced.Message
+		}
+	case !r.everSynced:
+		synced.Status = corev1.ConditionFalse
+		synced.Reason = ReasonNeverSynced
+		synced.Message = "waiting for the first sync"
+	case r.DryRun:
+		synced.Reason = ReasonDryRun
+		synced.Message = "dry run, configuration rendered but not applied"
+	}
+
+	ready := synced
+	ready.Type = wgv1alpha1.ConditionReady
+	if synced.Status == corev1.ConditionTrue && r.DryRun {
+		ready.Status = corev1.ConditionFalse
+		ready.Message = "dry run, the interface isn't configured"
+	} else if synced.Status == corev1.ConditionTrue && deviceErr != nil {
+		ready.Status = corev1.ConditionFalse
+		ready.Reason = ReasonDeviceUnavailable
+		ready.Message = deviceErr.Error()
+	} else if synced.Status == corev1.ConditionTrue {
+		ready.Message = "interface is up and configured"
+	}
+
+	keyMismatch := wgv1alpha1.Condition{
+		Type:               wgv1alpha1.ConditionKeyMismatch,
+		Status:             corev1.ConditionFalse,
+		Reason:             ReasonKeyMatches,
+		ObservedGeneration: r.observedGeneration,
+	}
+	if r.lastSyncErr != nil && reasonOf(r.lastSyncErr) == ReasonKeyMismatch {
+		keyMismatch.Status = corev1.ConditionTrue
+		keyMismatch.Reason = ReasonKeyMismatch
+		keyMismatch.Message = r.lastSyncErr.Error()
+	}
+
+	resolved := wgv1alpha1.Condition{
+		Type:               wgv1alpha1.ConditionEndpointsResolved,
+		Status:             corev1.ConditionTrue,
+		Reason:             ReasonResolved,
+		ObservedGeneration: r.observedGeneration,
+	}
+	if failures := r.resolver.failures(); len(failures) > 0 {
+		resolved.Status = corev1.ConditionFalse
+		resolved.Reason = ReasonResolveFailed
+		msgs := make([]string, len(failures))
+		for i, f := range failures {
+			msgs[i] = f.message
+		}
+		resolved.Message = strings.Join(msgs, "; ")
+	}
+
+	for _, c := range []wgv1alpha1.Condition{ready, synced, degraded, keyMismatch, resolved} {
+		wgv1alpha1.SetCondition(&status.Conditions, c)
+	}
+}
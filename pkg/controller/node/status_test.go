@@ -0,0 +1,91 @@
+package node
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestSetConditions(t *testing.T) {
+	type want struct {
+		status corev1.ConditionStatus
+		reason string
+	}
+	tests := []struct {
+		name                    string
+		everSynced, dryRun      bool
+		syncErr, deviceErr      error
+		ready, synced, degraded want
+	}{
+		{"never synced", false, false, nil, nil,
+			want{corev1.ConditionFalse, ReasonNeverSynced}, want{corev1.ConditionFalse, ReasonNeverSynced}, want{corev1.ConditionFalse, ReasonSynced}},
+		{"synced", true, false, nil, nil,
+			want{corev1.ConditionTrue, ReasonSynced}, want{corev1.ConditionTrue, ReasonSynced}, want{corev1.ConditionFalse, ReasonSynced}},
+		{"device gone", true, false, nil, errors.New("no such device"),
+			want{corev1.ConditionFalse, ReasonDeviceUnavailable}, want{corev1.ConditionTrue, ReasonSynced}, want{corev1.ConditionFalse, ReasonSynced}},
+		{"first sync failed", false, false, withReason(ReasonApplyFailed, errors.New("boom")), nil,
+			want{corev1.ConditionFalse, ReasonApplyFailed}, want{corev1.ConditionFalse, ReasonApplyFailed}, want{corev1.ConditionFalse, ReasonSynced}},
+		{"later sync failed", true, false, withReason(ReasonApplyFailed, errors.New("boom")), nil,
+			want{corev1.ConditionFalse, ReasonApplyFailed}, want{corev1.ConditionFalse, ReasonApplyFailed}, want{corev1.ConditionTrue, ReasonApplyFailed}},
+		{"dry run", true, true, nil, nil,
+			want{corev1.ConditionFalse, ReasonDryRun}, want{corev1.ConditionTrue, ReasonDryRun}, want{corev1.ConditionFalse, ReasonSynced}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &nodeController{
+				NodeControllerConfig: NodeControllerConfig{DryRun: tt.dryRun},
+				resolver:             newEndpointResolver(time.Minute, false),
+				everSynced:           tt.everSynced,
+				lastSyncErr:          tt.syncErr,
+				observedGeneration:   3,
+			}
+			status := &wgv1alpha1.CommonStatus{}
+			r.setConditions(status, tt.deviceErr)
+			for typ, w := range map[wgv1alpha1.ConditionType]want{
+				wgv1alpha1.ConditionReady:    tt.ready,
+				wgv1alpha1.ConditionSynced:   tt.synced,
+				wgv1alpha1.ConditionDegraded: tt.degraded,
+			} {
+				c := wgv1alpha1.GetCondition(status.Conditions, typ)
+				if c == nil {
+					t.Errorf("%s not set", typ)
+					continue
+				}
+				if c.Status != w.status || c.Reason != w.reason || c.ObservedGeneration != 3 {
+					t.Errorf("%s = %s/%s generation %d, want %s/%s generation 3", typ, c.Status, c.Reason, c.ObservedGeneration, w.status, w.reason)
+				}
+			}
+		})
+	}
+}
+
+// TestSetConditions_transition checks a recovering node flips Ready and Degraded, with a new transition time
+func TestSetConditions_transition(t *testing.T) {
+	r := &nodeController{
+		resolver:    newEndpointResolver(time.Minute, false),
+		everSynced:  true,
+		lastSyncErr: withReason(ReasonApplyFailed, errors.New("boom")),
+	}
+	status := &wgv1alpha1.CommonStatus{}
+	r.setConditions(status, nil)
+	failedAt := wgv1alpha1.GetCondition(status.Conditions, wgv1alpha1.ConditionReady).LastTransitionTime
+
+	// the same outcome keeps the transition time
+	r.setConditions(status, nil)
+	if got := wgv1alpha1.GetCondition(status.Conditions, wgv1alpha1.ConditionReady).LastTransitionTime; !got.Equal(&failedAt) {
+		t.Errorf("Ready transitioned at %v without changing, want %v", got, failedAt)
+	}
+
+	r.lastSyncErr = nil
+	r.setConditions(status, nil)
+	ready := wgv1alpha1.GetCondition(status.Conditions, wgv1alpha1.ConditionReady)
+	if ready.Status != corev1.ConditionTrue || ready.LastTransitionTime.Equal(&failedAt) {
+		t.Errorf("Ready = %+v, want True with a new transition time", *ready)
+	}
+	if degraded := wgv1alpha1.GetCondition(status.Conditions, wgv1alpha1.ConditionDegraded); degraded.Status != corev1.ConditionFalse {
+		t.Errorf("Degraded = %+v, want False", *degraded)
+	}
+}
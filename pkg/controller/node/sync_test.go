@@ -0,0 +1,227 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/apis"
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/backend"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestServer returns the controller of server gateway, peering with client laptop, on the fake backend.
+// The returned func cleans up
+func newTestServer(t *testing.T) (*nodeController, *backend.Fake, wgtypes.Key, func()) {
+	if err := apis.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	srvKey, _ := wgtypes.GeneratePrivateKey()
+	clKey, _ := wgtypes.GeneratePrivateKey()
+	keyFile, err := ioutil.TempFile("", "wg-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { os.Remove(keyFile.Name()) }
+	if _, err := keyFile.WriteString(srvKey.String()); err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	keyFile.Close()
+
+	srv := &wgv1alpha1.Server{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "wg"},
+		Spec: wgv1alpha1.ServerSpec{
+			CommonSpec: wgv1alpha1.CommonSpec{
+				PublicKey:  srvKey.PublicKey().String(),
+				Addresses:  []string{"10.0.0.1/24"},
+				AllowedIPs: []string{"10.0.0.1/32"},
+			},
+			Endpoint: "192.0.2.1:51820",
+		},
+	}
+	laptop := &wgv1alpha1.Client{
+		ObjectMeta: metav1.ObjectMeta{Name: "laptop", Namespace: "wg"},
+		Spec: wgv1alpha1.ClientSpec{
+			CommonSpec: wgv1alpha1.CommonSpec{
+				PublicKey:  clKey.PublicKey().String(),
+				Addresses:  []string{"10.0.0.2/32"},
+				AllowedIPs: []string{"10.0.0.2/32"},
+			},
+		},
+	}
+
+	b := backend.NewFake()
+	ctl := &nodeController{
+		NodeControllerConfig: NodeControllerConfig{
+			NodeName:       "gateway",
+			Namespace:      "wg",
+			Interface:      "wg0",
+			Mode:           Server,
+			PrivateKeyFile: keyFile.Name(),
+			RouteProto:     121,
+			Backend:        b,
+		},
+		client:   fake.NewFakeClient(srv, laptop),
+		scheme:   scheme.Scheme,
+		resolver: newEndpointResolver(time.Minute, false),
+	}
+	return ctl, b, clKey.PublicKey(), cleanup
+}
+
+// TestSync runs syncs of a server against a fake cluster and the fake backend
+func TestSync(t *testing.T) {
+	ctl, b, laptop, cleanup := newTestServer(t)
+	defer cleanup()
+	log := logrus.WithField("iface", "wg0")
+
+	if err := ctl.sync(); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+	cfg, ok := b.Config("wg0")
+	if !ok {
+		t.Fatalf("wg0 wasn't synced, interfaces are %v", b.Interfaces())
+	}
+	if len(cfg.Peers) != 1 || cfg.Peers[0].PublicKey != laptop {
+		t.Fatalf("synced peers = %v, want laptop", cfg.Peers)
+	}
+	if got := cfg.Address; len(got) != 1 || got[0].String() != "10.0.0.1/24" {
+		t.Errorf("synced addresses = %v, want 10.0.0.1/24", got)
+	}
+	if ctl.changes.added != 1 || ctl.peerNames[laptop] != "laptop" {
+		t.Errorf("changes = %+v, peer names = %v, want laptop added", ctl.changes, ctl.peerNames)
+	}
+
+	// someone removes the peer and its route by hand
+	if err := b.ConfigureDevice("wg0", wgtypes.Config{Peers: []wgtypes.PeerConfig{{PublicKey: laptop, Remove: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	_, route, _ := net.ParseCIDR("10.0.0.2/32")
+	b.DeleteRoute("wg0", *route)
+	if !ctl.checkDrift(log) {
+		t.Fatal("checkDrift() found no drift")
+	}
+	d, err := detectDrift(b, "wg0", &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.peers.added != 1 || len(d.missingRoutes) != 1 {
+		t.Errorf("drift = %+v, want the peer and its route missing", d)
+	}
+
+	// the next sync corrects it
+	if err := ctl.sync(); err != nil {
+		t.Fatalf("sync() error = %v", err)
+	}
+	if ctl.checkDrift(log) {
+		t.Error("checkDrift() found drift after a sync")
+	}
+
+	b.SyncErr = os.ErrPermission
+	if err := ctl.sync(); reasonOf(err) != ReasonApplyFailed {
+		t.Errorf("sync() error = %v, want %s", err, ReasonApplyFailed)
+	}
+}
+
+// TestSync_teardown deletes the server's CR and checks its interface is taken down before the CR goes away
+func TestSync_teardown(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep=%v", keep), func(t *testing.T) {
+			ctl, b, _, cleanup := newTestServer(t)
+			defer cleanup()
+			ctl.KeepInterfaces = keep
+			ctx := context.Background()
+			key := client.ObjectKey{Name: "gateway", Namespace: "wg"}
+
+			if err := ctl.sync(); err != nil {
+				t.Fatalf("sync() error = %v", err)
+			}
+			srv := &wgv1alpha1.Server{}
+			if err := ctl.client.Get(ctx, key, srv); err != nil {
+				t.Fatal(err)
+			}
+			if !hasFinalizer(srv) {
+				t.Fatalf("finalizers = %v, want %s", srv.Finalizers, wgv1alpha1.InterfaceFinalizer)
+			}
+
+			// the fake client doesn't honour finalizers, mark the CR deleted like the API server would
+			now := metav1.Now()
+			srv.DeletionTimestamp = &now
+			if err := ctl.client.Update(ctx, srv); err != nil {
+				t.Fatal(err)
+			}
+			if err := ctl.sync(); err != nil {
+				t.Fatalf("sync() while deleting error = %v", err)
+			}
+			if _, up := b.Config("wg0"); up != keep {
+				t.Errorf("wg0 up = %v after deletion, want %v", up, keep)
+			}
+			if err := ctl.client.Get(ctx, key, srv); err != nil {
+				t.Fatal(err)
+			}
+			if hasFinalizer(srv) {
+				t.Errorf("finalizers = %v, want %s removed", srv.Finalizers, wgv1alpha1.InterfaceFinalizer)
+			}
+			if len(ctl.appliedInterfaces()) != 0 {
+				t.Errorf("applied interfaces = %v, want none", ctl.appliedInterfaces())
+			}
+
+			if err := ctl.client.Delete(ctx, srv); err != nil {
+				t.Fatal(err)
+			}
+			if err := ctl.sync(); err != nil {
+				t.Errorf("sync() once deleted error = %v, want nil", err)
+			}
+		})
+	}
+}
+
+// TestTakeDown_restart takes the interfaces down without a previous sync, like a restarted agent, and checks
+// the split interfaces recorded in the state file go along
+func TestTakeDown_restart(t *testing.T) {
+	ctl, b, _, cleanup := newTestServer(t)
+	defer cleanup()
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctl.SplitServers = true
+	ctl.StateFile = path.Join(dir, "interfaces")
+	log := logrus.WithField("iface", "wg0")
+
+	state := make(map[string]bool)
+	for _, iface := range []string{"wg0", "wg0-gateway", "wg1-gateway"} {
+		if err := b.Sync(&wgquick.Config{}, iface, log); err != nil {
+			t.Fatal(err)
+		}
+		state[iface] = true
+	}
+	if err := writeState(ctl.StateFile, state); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &wgv1alpha1.Server{}
+	if err := ctl.client.Get(context.Background(), client.ObjectKey{Name: "gateway", Namespace: "wg"}, srv); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctl.takeDown(srv, log); err != nil {
+		t.Fatalf("takeDown() error = %v", err)
+	}
+	if got, want := b.Interfaces(), []string{"wg1-gateway"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("interfaces after takeDown() = %v, want %v", got, want)
+	}
+}
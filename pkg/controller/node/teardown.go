@@ -0,0 +1,159 @@
+package node
+
+import (
+	"context"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/KrakenSystems/wg-operator/pkg/firewall"
+	"github.com/nmiculinic/wg-quick-go"
+	"github.com/sirupsen/logrus"
+)
+
+// hasFinalizer reports whether the node carries the interface finalizer
+func hasFinalizer(node wgv1alpha1.VPNNode) bool {
+	for _, f := range node.GetFinalizers() {
+		if f == wgv1alpha1.InterfaceFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// terminating reports whether the node is being deleted. Its peers drop it right away, without waiting
+// for its agent to take its interfaces down
+func terminating(node wgv1alpha1.VPNNode) bool {
+	return node.GetDeletionTimestamp() != nil
+}
+
+// addFinalizer makes my CR wait for my interfaces to be taken down when it's deleted
+func (r *nodeController) addFinalizer(ctx context.Context, me wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	if r.DryRun || hasFinalizer(me) {
+		return nil
+	}
+	me.SetFinalizers(append(me.GetFinalizers(), wgv1alpha1.InterfaceFinalizer))
+	if err := r.client.Update(ctx, me); err != nil {
+		return reasonf(ReasonTeardownFailed, "cannot add finalizer: %v", err)
+	}
+	log.Infoln("added finalizer")
+	return nil
+}
+
+// teardown takes my interfaces down once my CR is being deleted, unless they're kept, and then lets the CR go
+func (r *nodeController) teardown(ctx context.Context, me wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	if !r.tornDown {
+		if r.KeepInterfaces {
+			log.Infoln("being deleted, keeping the interfaces")
+		} else if err := r.takeDown(me, log); err != nil {
+			return err
+		}
+		r.forgetInterfaces()
+		r.tornDown = true
+	}
+
+	finalizers := me.GetFinalizers()
+	kept := finalizers[:0]
+	for _, f := range finalizers {
+		if f != wgv1alpha1.InterfaceFinalizer {
+			kept = append(kept, f)
+		}
+	}
+	if len(kept) == len(finalizers) || r.DryRun {
+		return nil
+	}
+	me.SetFinalizers(kept)
+	if err := r.client.Update(ctx, me); err != nil {
+		return reasonf(ReasonTeardownFailed, "cannot remove finalizer: %v", err)
+	}
+	log.Infoln("removed finalizer")
+	return nil
+}
+
+// takeDown removes the interfaces configured in the last successful sync, running their PreDown and PostDown
+// hooks, along with their synced config files and firewall tables. After a restart there's no such sync, so
+// the interfaces are taken down with the config of my CR as it is now: my interface, and the split ones the
+// state file records
+func (r *nodeController) takeDown(me wgv1alpha1.VPNNode, log logrus.FieldLogger) error {
+	configs := r.applied
+	if len(configs) == 0 {
+		cfg, err := me.ToInterfaceConfig(r.PrivateKeyFile)
+		if err != nil {
+			log.WithError(err).Warnln("cannot create interface config, taking the interfaces down without hooks")
+			cfg = &wgquick.Config{}
+		}
+		configs = map[string]wgquick.Config{r.Interface: *cfg}
+		for _, iface := range r.splitInterfaces(log) {
+			split := *cfg
+			split.ListenPort = nil
+			configs[iface] = split
+		}
+	}
+
+	for iface, cfg := range configs {
+		cfg := cfg
+		log := log.WithField("iface", iface)
+		if r.DryRun {
+			log.Infoln("Dry run, not taking the interface down")
+			continue
+		}
+		if err := r.Backend.Down(&cfg, iface, log); err != nil {
+			return reasonf(ReasonTeardownFailed, "cannot take interface %s down: %v", iface, err)
+		}
+		if r.SyncConfig {
+			pp := path.Join(r.SyncConfigPath, iface+".conf")
+			if err := os.Remove(pp); err != nil && !os.IsNotExist(err) {
+				return reasonf(ReasonTeardownFailed, "cannot remove config %s: %v", pp, err)
+			}
+		}
+		if r.Backend.ConfiguresHost() {
+			if err := firewall.Remove(iface); err != nil {
+				return reasonf(ReasonTeardownFailed, "cannot remove firewall rules on %s: %v", iface, err)
+			}
+		}
+		log.Infoln("took interface down")
+	}
+	return nil
+}
+
+// splitInterfaces returns the split interfaces of mine the state file records
+func (r *nodeController) splitInterfaces(log logrus.FieldLogger) []string {
+	if !r.SplitServers || r.StateFile == "" {
+		return nil
+	}
+	state, err := readState(r.StateFile)
+	if err != nil {
+		log.WithError(err).Warnln("cannot read interface state, split interfaces are left to the stale interface removal")
+		return nil
+	}
+	var ifaces []string
+	for iface := range state {
+		if strings.HasPrefix(iface, r.Interface+"-") {
+			ifaces = append(ifaces, iface)
+		}
+	}
+	sort.Strings(ifaces)
+	return ifaces
+}
+
+// forgetInterfaces drops everything known about the interfaces of the last successful sync, so nothing
+// refers to them anymore
+func (r *nodeController) forgetInterfaces() {
+	for iface := range r.applied {
+		forgetInterface(iface)
+	}
+	r.mu.Lock()
+	r.interfaces = nil
+	r.mu.Unlock()
+	r.applied = nil
+	r.peerNames, r.acknowledgedKeys = nil, nil
+	r.endpointPeers = nil
+	r.resolver.begin()
+	r.resolver.end()
+	r.changes = peerChanges{}
+	r.firewallInstalled = false
+	r.nextRotation, r.nextPSKSwitch = time.Time{}, time.Time{}
+}
@@ -0,0 +1,301 @@
+package psk
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/mdlayher/wireguardctrl/wgtypes"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// RotatedAtAnnotation records when the preshared key in a generated Secret was last (re)generated
+const RotatedAtAnnotation = "wg.krakensystems.co/psk-rotated-at"
+
+// activationDelay is how long a rotated key is staged before the pair switches over to it. Agents pick the staged
+// key up through their watches well before, and switch at the same time instead of whenever they resync
+const activationDelay = time.Minute
+
+type Config struct {
+	Namespace string
+	// RotationInterval after which generated preshared keys are replaced, 0 disables rotation
+	RotationInterval time.Duration
+}
+
+// pskController generates and rotates per pair preshared key Secrets for servers with presharedKey.perPair set
+type pskController struct {
+	Config
+	client client.Client
+	scheme *runtime.Scheme
+}
+
+var _ reconcile.Reconciler = (*pskController)(nil)
+
+// peersOf lists the names of all peers a server owns the preshared keys with
+func (r *pskController) peersOf(ctx context.Context, server *wgv1alpha1.Server) ([]string, error) {
+	clients := &wgv1alpha1.ClientList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, clients); err != nil {
+		return nil, fmt.Errorf("cannot list clients: %v", err)
+	}
+	servers := &wgv1alpha1.ServerList{}
+	if err := r.client.List(ctx, &client.ListOptions{Namespace: r.Namespace}, servers); err != nil {
+		return nil, fmt.Errorf("cannot list servers: %v", err)
+	}
+
+	var peers []string
+	for i := range clients.Items {
+		cl := &clients.Items[i]
+		if cl.Name == server.Name {
+			continue
+		}
+		if ok, err := wgv1alpha1.Peers(server, cl); err != nil || !ok {
+			continue
+		}
+		peers = append(peers, cl.Name)
+	}
+	for i := range servers.Items {
+		srv := &servers.Items[i]
+		if srv.Name != server.Name && wgv1alpha1.SameNetwork(server, srv) && wgv1alpha1.OwnsPresharedKey(server.Name, srv.Name) {
+			peers = append(peers, srv.Name)
+		}
+	}
+	return peers, nil
+}
+
+func secretName(server, peer string) string {
+	return fmt.Sprintf("psk-%s-%s", server, peer)
+}
+
+func (r *pskController) Reconcile(request reconcile.Request) (reconcile.Result, error) {
+	ctx := context.Background()
+	log := logrus.WithField("server", request.Name)
+
+	server := &wgv1alpha1.Server{}
+	if err := r.client.Get(ctx, request.NamespacedName, server); err != nil {
+		if apierrors.IsNotFound(err) {
+			// generated secrets are garbage collected through their controller reference to the server
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	// servers which stopped using per pair keys keep none of the generated secrets
+	var peers []string
+	if server.Spec.PresharedKey != nil && server.Spec.PresharedKey.PerPair {
+		var err error
+		if peers, err = r.peersOf(ctx, server); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if err := r.deleteOrphans(ctx, server, peers, log); err != nil {
+		return reconcile.Result{}, err
+	}
+
+	now := time.Now()
+	var requeue time.Duration
+	for _, p := range peers {
+		next, err := r.ensureSecret(ctx, server, p, now, log.WithField("peer", p))
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+		if next > 0 && (requeue == 0 || next < requeue) {
+			requeue = next
+		}
+	}
+	return reconcile.Result{RequeueAfter: requeue}, nil
+}
+
+// ensureSecret creates or rotates the pair's secret. It returns time until the next rotation is due. Only the
+// server owns the secret: the garbage collector keeps a secret while any of its owners is left, so a peer
+// owning it too would keep it around after the server is gone. Secrets of deleted peers are left to
+// deleteOrphans instead
+func (r *pskController) ensureSecret(ctx context.Context, server *wgv1alpha1.Server, peer string, now time.Time, log logrus.FieldLogger) (time.Duration, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: server.Namespace, Name: secretName(server.Name, peer)}, secret)
+	switch {
+	case apierrors.IsNotFound(err):
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      secretName(server.Name, peer),
+				Namespace: server.Namespace,
+				Labels: map[string]string{
+					wgv1alpha1.PSKServerLabel: server.Name,
+					wgv1alpha1.PSKPeerLabel:   peer,
+				},
+			},
+			Type: corev1.SecretTypeOpaque,
+		}
+		if err := controllerutil.SetControllerReference(server, secret, r.scheme); err != nil {
+			return 0, err
+		}
+		if err := setKey(secret, now); err != nil {
+			return 0, err
+		}
+		if err := r.client.Create(ctx, secret); err != nil {
+			return 0, fmt.Errorf("cannot create secret %s: %v", secret.Name, err)
+		}
+		log.Infoln("generated preshared key")
+		return r.RotationInterval, nil
+	case err != nil:
+		return 0, err
+	}
+
+	// the staged key becomes the current one once both sides switched over to it
+	if _, ok := secret.Data[wgv1alpha1.PSKNextSecretKey]; ok {
+		activateAt, err := time.Parse(time.RFC3339, secret.Annotations[wgv1alpha1.PSKActivateAtAnnotation])
+		if err == nil && now.Before(activateAt) {
+			return activateAt.Sub(now), nil
+		}
+		promoteKey(secret, now)
+		if err := r.client.Update(ctx, secret); err != nil {
+			return 0, fmt.Errorf("cannot promote next key of secret %s: %v", secret.Name, err)
+		}
+		log.Infoln("rotated preshared key")
+		return r.RotationInterval, nil
+	}
+
+	if r.RotationInterval <= 0 {
+		return 0, nil
+	}
+	rotatedAt, err := time.Parse(time.RFC3339, secret.Annotations[RotatedAtAnnotation])
+	if err == nil && now.Sub(rotatedAt) < r.RotationInterval {
+		return r.RotationInterval - now.Sub(rotatedAt), nil
+	}
+	if err := stageKey(secret, now.Add(activationDelay)); err != nil {
+		return 0, err
+	}
+	if err := r.client.Update(ctx, secret); err != nil {
+		return 0, fmt.Errorf("cannot stage next key of secret %s: %v", secret.Name, err)
+	}
+	log.WithField("activate_at", secret.Annotations[wgv1alpha1.PSKActivateAtAnnotation]).Infoln("staged next preshared key")
+	return activationDelay, nil
+}
+
+// deleteOrphans deletes the secrets generated for the server's pairs which no longer peer, or all of them once the
+// server stops using per pair keys. Secrets the server doesn't control are left alone, they're provided by hand
+func (r *pskController) deleteOrphans(ctx context.Context, server *wgv1alpha1.Server, peers []string, log logrus.FieldLogger) error {
+	secrets := &corev1.SecretList{}
+	opts := (&client.ListOptions{Namespace: server.Namespace}).MatchingLabels(map[string]string{wgv1alpha1.PSKServerLabel: server.Name})
+	if err := r.client.List(ctx, opts, secrets); err != nil {
+		return fmt.Errorf("cannot list secrets: %v", err)
+	}
+	current := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		current[secretName(server.Name, p)] = true
+	}
+	for i := range secrets.Items {
+		s := &secrets.Items[i]
+		if current[s.Name] || !metav1.IsControlledBy(s, server) {
+			continue
+		}
+		if err := r.client.Delete(ctx, s); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("cannot delete secret %s: %v", s.Name, err)
+		}
+		log.WithField("peer", s.Labels[wgv1alpha1.PSKPeerLabel]).Infoln("deleted preshared key of former peer")
+	}
+	return nil
+}
+
+func setKey(secret *corev1.Secret, now time.Time) error {
+	key, err := wgtypes.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("cannot generate preshared key: %v", err)
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[RotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+	secret.Data = map[string][]byte{wgv1alpha1.PSKSecretKey: []byte(key.String())}
+	return nil
+}
+
+// stageKey adds a new key next to the current one, which the pair switches over to at activateAt
+func stageKey(secret *corev1.Secret, activateAt time.Time) error {
+	key, err := wgtypes.GenerateKey()
+	if err != nil {
+		return fmt.Errorf("cannot generate preshared key: %v", err)
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Annotations[wgv1alpha1.PSKActivateAtAnnotation] = activateAt.UTC().Format(time.RFC3339)
+	secret.Data[wgv1alpha1.PSKNextSecretKey] = []byte(key.String())
+	return nil
+}
+
+// promoteKey replaces the current key with the staged one
+func promoteKey(secret *corev1.Secret, now time.Time) {
+	secret.Data[wgv1alpha1.PSKSecretKey] = secret.Data[wgv1alpha1.PSKNextSecretKey]
+	delete(secret.Data, wgv1alpha1.PSKNextSecretKey)
+	delete(secret.Annotations, wgv1alpha1.PSKActivateAtAnnotation)
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[RotatedAtAnnotation] = now.UTC().Format(time.RFC3339)
+}
+
+// Add creates a new preshared key controller and adds it to the Manager
+func Add(mgr manager.Manager, config Config) error {
+	r := &pskController{
+		Config: config,
+		client: mgr.GetClient(),
+		scheme: mgr.GetScheme(),
+	}
+
+	c, err := controller.New("psk-controller", mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	if err := c.Watch(&source.Kind{Type: &corev1.Secret{}}, &handler.EnqueueRequestForOwner{
+		OwnerType:    &wgv1alpha1.Server{},
+		IsController: true,
+	}); err != nil {
+		return err
+	}
+
+	// pairs change with the spec and labels of servers and clients, not with the status their agents keep reporting
+	peering := predicate.Funcs{
+		UpdateFunc: func(ev event.UpdateEvent) bool {
+			return ev.MetaOld.GetGeneration() != ev.MetaNew.GetGeneration() ||
+				!reflect.DeepEqual(ev.MetaOld.GetLabels(), ev.MetaNew.GetLabels())
+		},
+	}
+
+	// any new peer, client or server, needs secrets with every server
+	allServers := &handler.EnqueueRequestsFromMapFunc{
+		ToRequests: handler.ToRequestsFunc(func(o handler.MapObject) []reconcile.Request {
+			servers := &wgv1alpha1.ServerList{}
+			if err := r.client.List(context.Background(), &client.ListOptions{Namespace: config.Namespace}, servers); err != nil {
+				logrus.WithError(err).Errorln("cannot list servers")
+				return nil
+			}
+			reqs := make([]reconcile.Request, 0, len(servers.Items))
+			for _, srv := range servers.Items {
+				reqs = append(reqs, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: srv.Namespace, Name: srv.Name}})
+			}
+			return reqs
+		}),
+	}
+	if err := c.Watch(&source.Kind{Type: &wgv1alpha1.Client{}}, allServers, peering); err != nil {
+		return err
+	}
+	return c.Watch(&source.Kind{Type: &wgv1alpha1.Server{}}, allServers, peering)
+}
@@ -0,0 +1,147 @@
+package psk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/apis"
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func newTestController(t *testing.T, objs ...runtime.Object) *pskController {
+	if err := apis.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	return &pskController{
+		Config: Config{Namespace: "wg", RotationInterval: time.Hour},
+		client: fake.NewFakeClient(objs...),
+		scheme: scheme.Scheme,
+	}
+}
+
+func getSecret(t *testing.T, r *pskController, name string) *corev1.Secret {
+	secret := &corev1.Secret{}
+	if err := r.client.Get(context.Background(), client.ObjectKey{Namespace: "wg", Name: name}, secret); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// TestEnsureSecret_rotation checks a due key is staged first and only replaces the current one once it took effect
+func TestEnsureSecret_rotation(t *testing.T) {
+	server := &wgv1alpha1.Server{ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "wg", UID: "1"}}
+	r := newTestController(t, server)
+	ctx, log := context.Background(), logrus.New()
+	p := "laptop"
+	name := secretName("gateway", "laptop")
+	created := time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	if next, err := r.ensureSecret(ctx, server, p, created, log); err != nil || next != time.Hour {
+		t.Fatalf("ensureSecret() = %v, %v, want 1h", next, err)
+	}
+	first := string(getSecret(t, r, name).Data[wgv1alpha1.PSKSecretKey])
+
+	due := created.Add(time.Hour)
+	if next, err := r.ensureSecret(ctx, server, p, due, log); err != nil || next != activationDelay {
+		t.Fatalf("ensureSecret() = %v, %v, want %v", next, err, activationDelay)
+	}
+	staged := getSecret(t, r, name)
+	next := string(staged.Data[wgv1alpha1.PSKNextSecretKey])
+	if got := string(staged.Data[wgv1alpha1.PSKSecretKey]); got != first || next == "" || next == first {
+		t.Fatalf("staged secret = %q next %q, want %q next a new key", got, next, first)
+	}
+	if got, want := staged.Annotations[wgv1alpha1.PSKActivateAtAnnotation], due.Add(activationDelay).Format(time.RFC3339); got != want {
+		t.Errorf("activation at %q, want %q", got, want)
+	}
+
+	// nothing changes until the staged key takes effect
+	if wait, err := r.ensureSecret(ctx, server, p, due.Add(activationDelay/2), log); err != nil || wait != activationDelay/2 {
+		t.Fatalf("ensureSecret() = %v, %v, want %v", wait, err, activationDelay/2)
+	}
+
+	if wait, err := r.ensureSecret(ctx, server, p, due.Add(activationDelay), log); err != nil || wait != time.Hour {
+		t.Fatalf("ensureSecret() = %v, %v, want 1h", wait, err)
+	}
+	promoted := getSecret(t, r, name)
+	if got := string(promoted.Data[wgv1alpha1.PSKSecretKey]); got != next {
+		t.Errorf("current key = %q, want the staged %q", got, next)
+	}
+	if _, ok := promoted.Data[wgv1alpha1.PSKNextSecretKey]; ok {
+		t.Error("staged key kept after promotion")
+	}
+	if _, ok := promoted.Annotations[wgv1alpha1.PSKActivateAtAnnotation]; ok {
+		t.Error("activation time kept after promotion")
+	}
+}
+
+func TestDeleteOrphans(t *testing.T) {
+	server := &wgv1alpha1.Server{ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "wg", UID: "1"}}
+	controlled := func(peer string) *corev1.Secret {
+		isController := true
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+			Name:      secretName("gateway", peer),
+			Namespace: "wg",
+			Labels:    map[string]string{wgv1alpha1.PSKServerLabel: "gateway", wgv1alpha1.PSKPeerLabel: peer},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: wgv1alpha1.SchemeGroupVersion.String(), Kind: "Server", Name: "gateway", UID: "1", Controller: &isController,
+			}},
+		}}
+	}
+	byHand := controlled("phone")
+	byHand.OwnerReferences = nil
+	r := newTestController(t, server, controlled("laptop"), controlled("desktop"), byHand)
+
+	peers := []string{"laptop"}
+	if err := r.deleteOrphans(context.Background(), server, peers, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	for name, wantKept := range map[string]bool{"laptop": true, "desktop": false, "phone": true} {
+		err := r.client.Get(context.Background(), client.ObjectKey{Namespace: "wg", Name: secretName("gateway", name)}, &corev1.Secret{})
+		if kept := !apierrors.IsNotFound(err); kept != wantKept {
+			t.Errorf("secret of %s kept = %v (%v), want %v", name, kept, err, wantKept)
+		}
+	}
+}
+
+// TestReconcile_peerDeleted checks a deleted peer's secret goes, while the server remains its only owner
+func TestReconcile_peerDeleted(t *testing.T) {
+	server := &wgv1alpha1.Server{ObjectMeta: metav1.ObjectMeta{Name: "gateway", Namespace: "wg", UID: "1"}}
+	server.Spec.PresharedKey = &wgv1alpha1.PresharedKeySpec{PerPair: true}
+	laptop := &wgv1alpha1.Client{ObjectMeta: metav1.ObjectMeta{Name: "laptop", Namespace: "wg", UID: "2"}}
+	desktop := &wgv1alpha1.Client{ObjectMeta: metav1.ObjectMeta{Name: "desktop", Namespace: "wg", UID: "3"}}
+	r := newTestController(t, server, laptop, desktop)
+	ctx := context.Background()
+	request := reconcile.Request{NamespacedName: client.ObjectKey{Namespace: "wg", Name: "gateway"}}
+
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	for _, peer := range []string{"laptop", "desktop"} {
+		refs := getSecret(t, r, secretName("gateway", peer)).OwnerReferences
+		if len(refs) != 1 || refs[0].UID != server.UID {
+			t.Errorf("secret of %s owned by %v, want only the server", peer, refs)
+		}
+	}
+
+	if err := r.client.Delete(ctx, laptop); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(request); err != nil {
+		t.Fatal(err)
+	}
+	err := r.client.Get(ctx, client.ObjectKey{Namespace: "wg", Name: secretName("gateway", "laptop")}, &corev1.Secret{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("secret of the deleted peer: %v, want it deleted", err)
+	}
+	getSecret(t, r, secretName("gateway", "desktop"))
+}
@@ -0,0 +1,301 @@
+// Package firewall renders and applies the nftables rules the agent owns for a wireguard interface.
+// Each interface gets its own tables, which are replaced atomically as a whole, so rules the agent no
+// longer wants never linger and nothing outside of them is touched
+package firewall
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TablePrefix starts the names of the agent's tables, followed by the interface name
+const TablePrefix = "wg_operator_"
+
+// Masquerade NATs traffic from Sources leaving through EgressInterface to its address
+type Masquerade struct {
+	// EgressInterface the traffic leaves through, any but the wireguard interface if empty
+	EgressInterface string
+	Sources         []*net.IPNet
+}
+
+// Isolation limits traffic entering through the wireguard interface from Sources, a peer's allowed IPs,
+// to the Allowed destinations. Replies to allowed traffic pass
+type Isolation struct {
+	Sources []*net.IPNet
+	Allowed []Destination
+}
+
+// Destination is a set of CIDRs and ports. Empty CIDRs match any address, empty Ports any port and protocol
+type Destination struct {
+	CIDRs []*net.IPNet
+	Ports []Port
+}
+
+// Port is a single port, or a range if EndPort is set. Port 0 matches the whole protocol
+type Port struct {
+	// Protocol is tcp, udp or sctp
+	Protocol string
+	Port     int
+	EndPort  int
+}
+
+// Ruleset is the firewall state of a single wireguard interface
+type Ruleset struct {
+	Interface  string
+	Masquerade []Masquerade
+	Isolation  []Isolation
+}
+
+// Empty reports whether the ruleset has no rules, so the interface's tables are removed
+func (rs Ruleset) Empty() bool {
+	return len(rs.Masquerade) == 0 && len(rs.Isolation) == 0
+}
+
+// families returns whether the ruleset has rules for IPv4 and IPv6 traffic
+func (rs Ruleset) families() (ipv4, ipv6 bool) {
+	for _, m := range rs.Masquerade {
+		for _, s := range m.Sources {
+			if s.IP.To4() != nil {
+				ipv4 = true
+			} else {
+				ipv6 = true
+			}
+		}
+	}
+	return ipv4, ipv6
+}
+
+var unsafe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// TableName is the name of the interface's tables
+func TableName(iface string) string {
+	return TablePrefix + unsafe.ReplaceAllString(iface, "_")
+}
+
+// Render returns an nft script replacing the interface's tables with the ruleset. Declaring a table before
+// deleting it makes the deletion succeed whether it existed or not
+func Render(rs Ruleset) string {
+	table := TableName(rs.Interface)
+	var b bytes.Buffer
+	for _, family := range []string{"ip", "ip6", "inet"} {
+		fmt.Fprintf(&b, "table %s %s\ndelete table %s %s\n", family, table, family, table)
+	}
+	for _, family := range []string{"ip", "ip6"} {
+		var rules []string
+		for _, m := range rs.Masquerade {
+			if r := masqueradeRule(rs.Interface, m, family); r != "" {
+				rules = append(rules, r)
+			}
+		}
+		if len(rules) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "table %s %s {\n", family, table)
+		b.WriteString("\tchain postrouting {\n\t\ttype nat hook postrouting priority 100; policy accept;\n")
+		for _, r := range rules {
+			b.WriteString("\t\t" + r + "\n")
+		}
+		b.WriteString("\t}\n}\n")
+	}
+	if len(rs.Isolation) > 0 {
+		renderIsolation(&b, table, rs.Interface, rs.Isolation)
+	}
+	return b.String()
+}
+
+// renderIsolation jumps from the input and forward hooks to a chain per isolated peer, which accepts its
+// allowed destinations and drops everything else
+func renderIsolation(b *bytes.Buffer, table, iface string, isolation []Isolation) {
+	fmt.Fprintf(b, "table inet %s {\n", table)
+	for i, iso := range isolation {
+		fmt.Fprintf(b, "\tchain peer_%d {\n", i)
+		for _, d := range iso.Allowed {
+			for _, r := range destinationRules(d) {
+				b.WriteString("\t\t" + r + " accept\n")
+			}
+		}
+		b.WriteString("\t\tdrop\n\t}\n")
+	}
+	for _, hook := range []string{"input", "forward"} {
+		fmt.Fprintf(b, "\tchain %s {\n\t\ttype filter hook %s priority 0; policy accept;\n", hook, hook)
+		fmt.Fprintf(b, "\t\tiifname != %q accept\n", iface)
+		b.WriteString("\t\tct state established,related accept\n")
+		for i, iso := range isolation {
+			for _, family := range []string{"ip", "ip6"} {
+				if sources := ofFamily(iso.Sources, family); len(sources) > 0 {
+					fmt.Fprintf(b, "\t\t%s saddr { %s } jump peer_%d\n", family, strings.Join(sources, ", "), i)
+				}
+			}
+		}
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+}
+
+// destinationRules renders the matches of a destination, one per address family and protocol
+func destinationRules(d Destination) []string {
+	var daddrs []string
+	if len(d.CIDRs) == 0 {
+		daddrs = []string{""}
+	}
+	for _, family := range []string{"ip", "ip6"} {
+		if cidrs := ofFamily(d.CIDRs, family); len(cidrs) > 0 {
+			daddrs = append(daddrs, fmt.Sprintf("%s daddr { %s }", family, strings.Join(cidrs, ", ")))
+		}
+	}
+
+	// port ranges grouped by protocol, in the order the protocols first appear
+	var protos []string
+	byProto := make(map[string][][2]int)
+	whole := make(map[string]bool)
+	for _, p := range d.Ports {
+		if _, ok := byProto[p.Protocol]; !ok && !whole[p.Protocol] {
+			protos = append(protos, p.Protocol)
+		}
+		if p.Port == 0 {
+			whole[p.Protocol] = true
+			continue
+		}
+		end := p.EndPort
+		if end < p.Port {
+			end = p.Port
+		}
+		byProto[p.Protocol] = append(byProto[p.Protocol], [2]int{p.Port, end})
+	}
+	var ports []string
+	for _, proto := range protos {
+		if whole[proto] {
+			ports = append(ports, "meta l4proto "+proto)
+		} else {
+			ports = append(ports, fmt.Sprintf("%s dport { %s }", proto, strings.Join(portRanges(byProto[proto]), ", ")))
+		}
+	}
+	if len(ports) == 0 {
+		ports = []string{""}
+	}
+
+	var rules []string
+	for _, a := range daddrs {
+		for _, p := range ports {
+			rules = append(rules, strings.TrimSpace(a+" "+p))
+		}
+	}
+	return rules
+}
+
+// portRanges merges overlapping and adjacent ranges, nft rejects overlapping elements of a set
+func portRanges(ranges [][2]int) []string {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+	var merged [][2]int
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	out := make([]string, len(merged))
+	for i, r := range merged {
+		out[i] = strconv.Itoa(r[0])
+		if r[1] > r[0] {
+			out[i] += "-" + strconv.Itoa(r[1])
+		}
+	}
+	return out
+}
+
+// ofFamily returns the networks of the family, ip or ip6, leaving out the ones another one covers since
+// nft rejects overlapping elements of a set
+func ofFamily(nets []*net.IPNet, family string) []string {
+	var own []*net.IPNet
+	for _, n := range nets {
+		if (n.IP.To4() != nil) == (family == "ip") {
+			own = append(own, &net.IPNet{IP: n.IP.Mask(n.Mask), Mask: n.Mask})
+		}
+	}
+	var out []string
+	for i, n := range own {
+		covered := false
+		for j, o := range own {
+			nOnes, _ := n.Mask.Size()
+			oOnes, _ := o.Mask.Size()
+			// of equal networks the first one stays
+			if i != j && o.Contains(n.IP) && (oOnes < nOnes || (oOnes == nOnes && j < i)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			out = append(out, n.String())
+		}
+	}
+	return out
+}
+
+// masqueradeRule renders the rule for the sources of the family, empty if there are none
+func masqueradeRule(iface string, m Masquerade, family string) string {
+	sources := ofFamily(m.Sources, family)
+	if len(sources) == 0 {
+		return ""
+	}
+	out := fmt.Sprintf("oifname != %q", iface)
+	if m.EgressInterface != "" {
+		out = fmt.Sprintf("oifname %q", m.EgressInterface)
+	}
+	return fmt.Sprintf("%s %s saddr { %s } masquerade", out, family, strings.Join(sources, ", "))
+}
+
+// Apply replaces the interface's tables with the ruleset and enables forwarding for its address families.
+// Forwarding is never disabled again, other services on the host may rely on it
+func Apply(rs Ruleset) error {
+	if rs.Empty() {
+		return Remove(rs.Interface)
+	}
+	ipv4, ipv6 := rs.families()
+	if err := EnableForwarding(ipv4, ipv6); err != nil {
+		return err
+	}
+	return nft(Render(rs))
+}
+
+// Remove deletes the interface's tables. Without nft installed there can't be any
+func Remove(iface string) error {
+	if _, err := exec.LookPath("nft"); err != nil {
+		return nil
+	}
+	return nft(Render(Ruleset{Interface: iface}))
+}
+
+func nft(script string) error {
+	cmd := exec.Command("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("nft failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// EnableForwarding turns on IP forwarding of the address families
+func EnableForwarding(ipv4, ipv6 bool) error {
+	if ipv4 {
+		if err := ioutil.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644); err != nil {
+			return fmt.Errorf("cannot enable IPv4 forwarding: %v", err)
+		}
+	}
+	if ipv6 {
+		if err := ioutil.WriteFile("/proc/sys/net/ipv6/conf/all/forwarding", []byte("1"), 0644); err != nil {
+			return fmt.Errorf("cannot enable IPv6 forwarding: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package firewall
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func cidrs(s ...string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, c := range s {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+const flush = `table ip wg_operator_wg0
+delete table ip wg_operator_wg0
+table ip6 wg_operator_wg0
+delete table ip6 wg_operator_wg0
+table inet wg_operator_wg0
+delete table inet wg_operator_wg0
+`
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		rs   Ruleset
+		want string
+	}{
+		{"empty removes the tables", Ruleset{Interface: "wg0"}, flush},
+		{"ipv4 to any other interface", Ruleset{Interface: "wg0", Masquerade: []Masquerade{{Sources: cidrs("10.0.0.0/24")}}}, flush + `table ip wg_operator_wg0 {
+	chain postrouting {
+		type nat hook postrouting priority 100; policy accept;
+		oifname != "wg0" ip saddr { 10.0.0.0/24 } masquerade
+	}
+}
+`},
+		{"dual-stack through eth0", Ruleset{Interface: "wg0", Masquerade: []Masquerade{{EgressInterface: "eth0", Sources: cidrs("10.0.0.0/24", "fd00::/64", "10.1.0.0/16")}}}, flush + `table ip wg_operator_wg0 {
+	chain postrouting {
+		type nat hook postrouting priority 100; policy accept;
+		oifname "eth0" ip saddr { 10.0.0.0/24, 10.1.0.0/16 } masquerade
+	}
+}
+table ip6 wg_operator_wg0 {
+	chain postrouting {
+		type nat hook postrouting priority 100; policy accept;
+		oifname "eth0" ip6 saddr { fd00::/64 } masquerade
+	}
+}
+`},
+		{"isolated peers", Ruleset{Interface: "wg0", Isolation: []Isolation{
+			{Sources: cidrs("10.0.0.2/32", "fd00::2/128"), Allowed: []Destination{{CIDRs: cidrs("10.20.0.0/16"), Ports: []Port{{Protocol: "tcp", Port: 443}}}}},
+			{Sources: cidrs("10.0.0.3/32")},
+		}}, flush + `table inet wg_operator_wg0 {
+	chain peer_0 {
+		ip daddr { 10.20.0.0/16 } tcp dport { 443 } accept
+		drop
+	}
+	chain peer_1 {
+		drop
+	}
+	chain input {
+		type filter hook input priority 0; policy accept;
+		iifname != "wg0" accept
+		ct state established,related accept
+		ip saddr { 10.0.0.2/32 } jump peer_0
+		ip6 saddr { fd00::2/128 } jump peer_0
+		ip saddr { 10.0.0.3/32 } jump peer_1
+	}
+	chain forward {
+		type filter hook forward priority 0; policy accept;
+		iifname != "wg0" accept
+		ct state established,related accept
+		ip saddr { 10.0.0.2/32 } jump peer_0
+		ip6 saddr { fd00::2/128 } jump peer_0
+		ip saddr { 10.0.0.3/32 } jump peer_1
+	}
+}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.rs); got != tt.want {
+				t.Errorf("Render() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableName(t *testing.T) {
+	for iface, want := range map[string]string{"wg0": "wg_operator_wg0", "wg-office.1": "wg_operator_wg_office_1"} {
+		if got := TableName(iface); got != want {
+			t.Errorf("TableName(%s) = %s, want %s", iface, got, want)
+		}
+	}
+}
+
+func Test_destinationRules(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Destination
+		want []string
+	}{
+		{"anything", Destination{}, []string{""}},
+		{"dual-stack cidrs", Destination{CIDRs: cidrs("10.20.0.0/16", "fd00:20::/64")}, []string{"ip daddr { 10.20.0.0/16 }", "ip6 daddr { fd00:20::/64 }"}},
+		{"covered cidrs are merged", Destination{CIDRs: cidrs("10.0.0.0/8", "10.20.0.0/16", "10.0.0.0/8")}, []string{"ip daddr { 10.0.0.0/8 }"}},
+		{"ports by protocol", Destination{Ports: []Port{{Protocol: "tcp", Port: 443}, {Protocol: "udp", Port: 53}, {Protocol: "tcp", Port: 22}}},
+			[]string{"tcp dport { 22, 443 }", "udp dport { 53 }"}},
+		{"overlapping ranges are merged", Destination{Ports: []Port{{Protocol: "tcp", Port: 8000, EndPort: 8080}, {Protocol: "tcp", Port: 8080, EndPort: 8090}, {Protocol: "tcp", Port: 8091}}},
+			[]string{"tcp dport { 8000-8091 }"}},
+		{"whole protocol", Destination{Ports: []Port{{Protocol: "udp", Port: 53}, {Protocol: "udp"}}}, []string{"meta l4proto udp"}},
+		{"cidrs and ports", Destination{CIDRs: cidrs("10.20.0.0/16", "fd00:20::/64"), Ports: []Port{{Protocol: "tcp", Port: 443}, {Protocol: "sctp"}}},
+			[]string{"ip daddr { 10.20.0.0/16 } tcp dport { 443 }", "ip daddr { 10.20.0.0/16 } meta l4proto sctp",
+				"ip6 daddr { fd00:20::/64 } tcp dport { 443 }", "ip6 daddr { fd00:20::/64 } meta l4proto sctp"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := destinationRules(tt.d); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("destinationRules() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
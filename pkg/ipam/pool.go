@@ -0,0 +1,322 @@
+// Package ipam allocates node addresses out of an AddressPool
+package ipam
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+)
+
+// Family of an IP address
+type Family string
+
+const (
+	IPv4 Family = "IPv4"
+	IPv6 Family = "IPv6"
+)
+
+// FamilyOf returns ip's address family
+func FamilyOf(ip net.IP) Family {
+	if ip.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
+
+// Pool tracks used addresses of an AddressPool. It's rebuilt from the nodes on every reconcile,
+// so addresses of deleted nodes are released implicitly.
+type Pool struct {
+	cidrs    []*net.IPNet
+	reserved []*net.IPNet
+	used     map[string]bool
+	settings map[Family]wgv1alpha1.AddressFamilySettings
+}
+
+// NewPool parses the pool's CIDRs and reserved ranges
+func NewPool(spec wgv1alpha1.AddressPoolSpec) (*Pool, error) {
+	p := &Pool{
+		used:     map[string]bool{},
+		settings: map[Family]wgv1alpha1.AddressFamilySettings{},
+	}
+	if spec.IPv4 != nil {
+		p.settings[IPv4] = *spec.IPv4
+	}
+	if spec.IPv6 != nil {
+		p.settings[IPv6] = *spec.IPv6
+	}
+	for _, c := range spec.CIDRs {
+		_, cidr, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse cidr %s: %v", c, err)
+		}
+		p.cidrs = append(p.cidrs, cidr)
+	}
+	for _, r := range spec.Reserved {
+		if !strings.Contains(r, "/") {
+			ip := net.ParseIP(r)
+			if ip == nil {
+				return nil, fmt.Errorf("cannot parse reserved address %s", r)
+			}
+			bits := 8 * len(normalize(ip))
+			p.reserved = append(p.reserved, &net.IPNet{IP: normalize(ip), Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(r)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse reserved cidr %s: %v", r, err)
+		}
+		p.reserved = append(p.reserved, cidr)
+	}
+	for f, s := range p.settings {
+		if s.PrefixLength < 0 || s.PrefixLength > hostBits(f) {
+			return nil, fmt.Errorf("invalid %s prefix length %d", f, s.PrefixLength)
+		}
+	}
+	return p, nil
+}
+
+func normalize(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+func hostBits(f Family) int {
+	if f == IPv4 {
+		return 32
+	}
+	return 128
+}
+
+// Contains reports whether ip is in one of the pool's CIDRs
+func (p *Pool) Contains(ip net.IP) bool {
+	for _, c := range p.cidrs {
+		if c.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Use marks ip as used. It returns false if ip is outside the pool or already in use
+func (p *Pool) Use(ip net.IP) bool {
+	if !p.Contains(ip) || p.used[normalize(ip).String()] {
+		return false
+	}
+	p.used[normalize(ip).String()] = true
+	return true
+}
+
+// Families returns address families nodes get an address from, IPv4 first
+func (p *Pool) Families() []Family {
+	var fs []Family
+	for _, f := range []Family{IPv4, IPv6} {
+		if p.settings[f].Disabled {
+			continue
+		}
+		for _, c := range p.cidrs {
+			if FamilyOf(c.IP) == f {
+				fs = append(fs, f)
+				break
+			}
+		}
+	}
+	return fs
+}
+
+// Allocate returns a free address of the family in CIDR notation, and marks it used
+func (p *Pool) Allocate(f Family) (string, error) {
+	for _, c := range p.cidrs {
+		if FamilyOf(c.IP) != f {
+			continue
+		}
+		for ip := normalize(c.IP); c.Contains(ip); ip = next(ip) {
+			if r := p.reservedNet(ip); r != nil {
+				// skip the whole reserved range, it may be huge in IPv6
+				ip = last(r)
+				continue
+			}
+			if !usable(ip, c) || p.used[ip.String()] {
+				continue
+			}
+			p.used[ip.String()] = true
+			return fmt.Sprintf("%s/%d", ip, p.prefixLength(f)), nil
+		}
+	}
+	return "", fmt.Errorf("no free %s addresses left", f)
+}
+
+func (p *Pool) prefixLength(f Family) int {
+	if pl := p.settings[f].PrefixLength; pl > 0 {
+		return pl
+	}
+	return hostBits(f)
+}
+
+func (p *Pool) reservedNet(ip net.IP) *net.IPNet {
+	for _, r := range p.reserved {
+		if r.Contains(ip) {
+			return r
+		}
+	}
+	return nil
+}
+
+// usable excludes the network address, and the IPv4 broadcast address, of subnets large enough to have them
+func usable(ip net.IP, c *net.IPNet) bool {
+	ones, bits := c.Mask.Size()
+	if bits-ones < 2 {
+		return true
+	}
+	if ip.Equal(c.IP) {
+		return false
+	}
+	return bits == 128 || !ip.Equal(last(c))
+}
+
+func next(ip net.IP) net.IP {
+	n := make(net.IP, len(ip))
+	copy(n, ip)
+	for i := len(n) - 1; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			break
+		}
+	}
+	return n
+}
+
+func last(c *net.IPNet) net.IP {
+	ip := normalize(c.IP)
+	l := make(net.IP, len(ip))
+	for i := range ip {
+		l[i] = ip[i] | ^c.Mask[len(c.Mask)-len(ip)+i]
+	}
+	return l
+}
+
+func size(c *net.IPNet) *big.Int {
+	ones, bits := c.Mask.Size()
+	return new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+}
+
+// capacity counts allocatable addresses of the family: the addresses of its CIDRs less the union of the ones
+// Allocate skips, the network and IPv4 broadcast addresses and the reserved ranges
+func (p *Pool) capacity(f Family) *big.Int {
+	total := new(big.Int)
+	for _, c := range p.cidrs {
+		if FamilyOf(c.IP) != f {
+			continue
+		}
+		lo, hi := toInt(c.IP), toInt(last(c))
+		var excluded []span
+		if ones, bits := c.Mask.Size(); bits-ones >= 2 {
+			excluded = append(excluded, span{lo, lo})
+			if bits == 32 {
+				excluded = append(excluded, span{hi, hi})
+			}
+		}
+		for _, r := range p.reserved {
+			if FamilyOf(r.IP) != f {
+				continue
+			}
+			s := span{toInt(r.IP), toInt(last(r))}
+			if s.from.Cmp(lo) < 0 {
+				s.from = lo
+			}
+			if s.to.Cmp(hi) > 0 {
+				s.to = hi
+			}
+			if s.from.Cmp(s.to) <= 0 {
+				excluded = append(excluded, s)
+			}
+		}
+		n := size(c)
+		total.Add(total, n.Sub(n, unionSize(excluded)))
+	}
+	return total
+}
+
+// span is an inclusive range of addresses
+type span struct {
+	from, to *big.Int
+}
+
+// unionSize counts the addresses in any of the spans
+func unionSize(spans []span) *big.Int {
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from.Cmp(spans[j].from) < 0 })
+	total := new(big.Int)
+	var cur *span
+	for i := range spans {
+		s := spans[i]
+		if cur != nil && s.from.Cmp(cur.to) <= 0 {
+			if s.to.Cmp(cur.to) > 0 {
+				cur.to = s.to
+			}
+			continue
+		}
+		if cur != nil {
+			total.Add(total, spanSize(*cur))
+		}
+		cur = &s
+	}
+	if cur != nil {
+		total.Add(total, spanSize(*cur))
+	}
+	return total
+}
+
+func spanSize(s span) *big.Int {
+	n := new(big.Int).Sub(s.to, s.from)
+	return n.Add(n, big.NewInt(1))
+}
+
+func toInt(ip net.IP) *big.Int {
+	return new(big.Int).SetBytes(normalize(ip))
+}
+
+// Usage reports capacity and utilization of each address family in the pool, along with utilization of the fullest one
+func (p *Pool) Usage() ([]wgv1alpha1.AddressFamilyStatus, string) {
+	allocated := map[Family]int{}
+	for a := range p.used {
+		allocated[FamilyOf(net.ParseIP(a))]++
+	}
+	var (
+		usage   []wgv1alpha1.AddressFamilyStatus
+		fullest float64
+	)
+	for _, f := range []Family{IPv4, IPv6} {
+		capacity := p.capacity(f)
+		if capacity.Sign() == 0 && allocated[f] == 0 {
+			continue
+		}
+		u := utilization(allocated[f], capacity)
+		if u > fullest {
+			fullest = u
+		}
+		usage = append(usage, wgv1alpha1.AddressFamilyStatus{
+			Family:      string(f),
+			Capacity:    capacity.String(),
+			Allocated:   allocated[f],
+			Utilization: formatPercent(u),
+		})
+	}
+	return usage, formatPercent(fullest)
+}
+
+func utilization(allocated int, capacity *big.Int) float64 {
+	if capacity.Sign() == 0 {
+		return 1
+	}
+	u, _ := new(big.Float).Quo(new(big.Float).SetInt64(int64(allocated)), new(big.Float).SetInt(capacity)).Float64()
+	return u
+}
+
+func formatPercent(u float64) string {
+	return fmt.Sprintf("%.1f%%", 100*u)
+}
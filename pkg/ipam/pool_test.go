@@ -0,0 +1,154 @@
+package ipam
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+)
+
+func TestPool_Allocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    wgv1alpha1.AddressPoolSpec
+		used    []string
+		family  Family
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "skips network address",
+			spec:   wgv1alpha1.AddressPoolSpec{CIDRs: []string{"10.0.0.0/24"}},
+			family: IPv4,
+			want:   []string{"10.0.0.1/32", "10.0.0.2/32"},
+		},
+		{
+			name:   "skips used and reserved",
+			spec:   wgv1alpha1.AddressPoolSpec{CIDRs: []string{"10.0.0.0/24"}, Reserved: []string{"10.0.0.1", "10.0.0.4/30"}},
+			used:   []string{"10.0.0.2", "10.0.0.3"},
+			family: IPv4,
+			want:   []string{"10.0.0.8/32"},
+		},
+		{
+			name:    "exhausted",
+			spec:    wgv1alpha1.AddressPoolSpec{CIDRs: []string{"10.0.0.0/30"}},
+			family:  IPv4,
+			want:    []string{"10.0.0.1/32", "10.0.0.2/32"},
+			wantErr: true,
+		},
+		{
+			name:   "continues with next cidr",
+			spec:   wgv1alpha1.AddressPoolSpec{CIDRs: []string{"10.0.0.0/31", "10.1.0.0/24"}},
+			family: IPv4,
+			want:   []string{"10.0.0.0/32", "10.0.0.1/32", "10.1.0.1/32"},
+		},
+		{
+			name:   "ipv6 skips huge reserved range",
+			spec:   wgv1alpha1.AddressPoolSpec{CIDRs: []string{"fd00::/64"}, Reserved: []string{"fd00::/65"}},
+			family: IPv6,
+			want:   []string{"fd00::8000:0:0:0/128"},
+		},
+		{
+			name: "prefix length",
+			spec: wgv1alpha1.AddressPoolSpec{
+				CIDRs: []string{"10.0.0.0/24", "fd00::/64"},
+				IPv4:  &wgv1alpha1.AddressFamilySettings{PrefixLength: 24},
+			},
+			family: IPv4,
+			want:   []string{"10.0.0.1/24"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPool(tt.spec)
+			if err != nil {
+				t.Fatalf("NewPool() error = %v", err)
+			}
+			for _, u := range tt.used {
+				if !p.Use(net.ParseIP(u)) {
+					t.Fatalf("Use(%s) = false", u)
+				}
+			}
+			var got []string
+			for range tt.want {
+				a, err := p.Allocate(tt.family)
+				if err != nil {
+					t.Fatalf("Allocate() error = %v", err)
+				}
+				got = append(got, a)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", got, tt.want)
+			}
+			if _, err := p.Allocate(tt.family); tt.wantErr && err == nil {
+				t.Errorf("Allocate() on exhausted pool succeeded")
+			}
+		})
+	}
+}
+
+func TestPool_Usage(t *testing.T) {
+	p, err := NewPool(wgv1alpha1.AddressPoolSpec{
+		CIDRs:    []string{"10.0.0.0/29", "fd00::/64"},
+		Reserved: []string{"10.0.0.1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3", "fd00::1"} {
+		p.Use(net.ParseIP(ip))
+	}
+	usage, fullest := p.Usage()
+	want := []wgv1alpha1.AddressFamilyStatus{
+		{Family: "IPv4", Capacity: "5", Allocated: 2, Utilization: "40.0%"},
+		{Family: "IPv6", Capacity: "18446744073709551615", Allocated: 1, Utilization: "0.0%"},
+	}
+	if !reflect.DeepEqual(usage, want) {
+		t.Errorf("Usage() = %v, want %v", usage, want)
+	}
+	if fullest != "40.0%" {
+		t.Errorf("Usage() fullest = %v, want 40.0%%", fullest)
+	}
+}
+
+func TestPool_capacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		cidrs    []string
+		reserved []string
+		want     string
+	}{
+		{"network and broadcast", []string{"10.0.0.0/29"}, nil, "6"},
+		{"reservation covering the network address", []string{"10.102.0.0/24"}, []string{"10.102.0.0/28"}, "239"},
+		{"reservation covering the broadcast address", []string{"10.0.0.0/29"}, []string{"10.0.0.6/31"}, "5"},
+		{"overlapping reservations", []string{"10.0.0.0/24"}, []string{"10.0.0.16/28", "10.0.0.20", "10.0.0.24/29"}, "238"},
+		{"reservation covering the CIDR", []string{"10.0.0.0/29"}, []string{"10.0.0.0/16"}, "0"},
+		{"reservation outside", []string{"10.0.0.0/29"}, []string{"10.0.1.0/24"}, "6"},
+		{"IPv6", []string{"fd00::/120"}, []string{"fd00::/124", "fd00::8"}, "240"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewPool(wgv1alpha1.AddressPoolSpec{CIDRs: tt.cidrs, Reserved: tt.reserved})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := FamilyOf(p.cidrs[0].IP)
+			if got := p.capacity(f).String(); got != tt.want {
+				t.Errorf("capacity() = %s, want %s", got, tt.want)
+			}
+			// every allocatable address is counted
+			allocated := 0
+			for {
+				if _, err := p.Allocate(f); err != nil {
+					break
+				}
+				allocated++
+			}
+			if got := fmt.Sprint(allocated); got != tt.want {
+				t.Errorf("allocated %s addresses, capacity %s", got, tt.want)
+			}
+		})
+	}
+}
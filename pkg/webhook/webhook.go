@@ -0,0 +1,229 @@
+// Package webhook serves the defaulting and validating admission webhooks for servers and clients
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	admissionregistrationv1beta1 "k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission/builder"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+type Config struct {
+	Namespace string
+	// Port the webhook server listens on
+	Port    int32
+	CertDir string
+	// ServiceName of the Service in front of the webhook server. The server generates its certificates
+	// into the ServiceName-cert Secret and registers the webhook configurations on start
+	ServiceName string
+}
+
+// nodeHandler decodes the admitted object into a fresh node
+type nodeHandler struct {
+	newNode func() wgv1alpha1.VPNNode
+	decoder atypes.Decoder
+}
+
+var _ inject.Decoder = (*nodeHandler)(nil)
+
+func (h *nodeHandler) InjectDecoder(d atypes.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+func (h *nodeHandler) decode(req atypes.Request) (wgv1alpha1.VPNNode, error) {
+	node := h.newNode()
+	if err := h.decoder.Decode(req, node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+type defaulter struct{ nodeHandler }
+
+var _ admission.Handler = (*defaulter)(nil)
+
+func (h *defaulter) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	node, err := h.decode(req)
+	if err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if node.GetDeletionTimestamp() != nil {
+		return admission.PatchResponse(node, node)
+	}
+	defaulted := node.DeepCopyObject().(wgv1alpha1.VPNNode)
+	defaulted.Default()
+	return admission.PatchResponse(node, defaulted)
+}
+
+// validator rejects invalid nodes. Deleted nodes and updates leaving the spec and annotations as they were,
+// e.g. removing a finalizer, are let through, so a node which became invalid, or was created before the
+// webhook, can still be deleted
+type validator struct{ nodeHandler }
+
+var _ admission.Handler = (*validator)(nil)
+
+func (h *validator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	node, err := h.decode(req)
+	if err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if node.GetDeletionTimestamp() != nil {
+		return admission.ValidationResponse(true, "")
+	}
+	same, err := unchanged(req)
+	if err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if same {
+		return admission.ValidationResponse(true, "")
+	}
+	if err := node.Validate(); err != nil {
+		return admission.ValidationResponse(false, err.Error())
+	}
+	return admission.ValidationResponse(true, "")
+}
+
+// unchanged reports whether the request updates an object without changing its spec or annotations
+func unchanged(req atypes.Request) (bool, error) {
+	if req.AdmissionRequest.Operation != admissionv1beta1.Update {
+		return false, nil
+	}
+	type validated struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+		Spec interface{} `json:"spec"`
+	}
+	var old, cur validated
+	if err := json.Unmarshal(req.AdmissionRequest.OldObject.Raw, &old); err != nil {
+		return false, fmt.Errorf("cannot decode old object: %v", err)
+	}
+	if err := json.Unmarshal(req.AdmissionRequest.Object.Raw, &cur); err != nil {
+		return false, fmt.Errorf("cannot decode object: %v", err)
+	}
+	return reflect.DeepEqual(old, cur), nil
+}
+
+// policyValidator rejects invalid peer policies, which servers would otherwise skip
+type policyValidator struct {
+	decoder atypes.Decoder
+}
+
+var _ admission.Handler = (*policyValidator)(nil)
+var _ inject.Decoder = (*policyValidator)(nil)
+
+func (h *policyValidator) InjectDecoder(d atypes.Decoder) error {
+	h.decoder = d
+	return nil
+}
+
+func (h *policyValidator) Handle(ctx context.Context, req atypes.Request) atypes.Response {
+	policy := &wgv1alpha1.PeerPolicy{}
+	if err := h.decoder.Decode(req, policy); err != nil {
+		return admission.ErrorResponse(http.StatusBadRequest, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return admission.ValidationResponse(false, err.Error())
+	}
+	return admission.ValidationResponse(true, "")
+}
+
+// build creates the defaulting and validating webhooks of the kind. Creates fail while the webhook server is
+// unavailable, updates don't: every deletion updates the node to drop its finalizers, and mustn't wait for the
+// controller serving the webhook
+func build(mgr manager.Manager, kind string, newNode func() wgv1alpha1.VPNNode) ([]webhook.Webhook, error) {
+	var webhooks []webhook.Webhook
+	for _, op := range []struct {
+		suffix string
+		op     admissionregistrationv1beta1.OperationType
+		policy admissionregistrationv1beta1.FailurePolicyType
+	}{
+		{"", admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Fail},
+		{"-update", admissionregistrationv1beta1.Update, admissionregistrationv1beta1.Ignore},
+	} {
+		mutating, err := builder.NewWebhookBuilder().
+			Name(fmt.Sprintf("default-%s%s.wg.krakensystems.co", kind, op.suffix)).
+			Path("/default-" + kind + op.suffix).
+			Mutating().
+			Operations(op.op).
+			FailurePolicy(op.policy).
+			WithManager(mgr).
+			ForType(newNode()).
+			Handlers(&defaulter{nodeHandler{newNode: newNode}}).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		validating, err := builder.NewWebhookBuilder().
+			Name(fmt.Sprintf("validate-%s%s.wg.krakensystems.co", kind, op.suffix)).
+			Path("/validate-" + kind + op.suffix).
+			Validating().
+			Operations(op.op).
+			FailurePolicy(op.policy).
+			WithManager(mgr).
+			ForType(newNode()).
+			Handlers(&validator{nodeHandler{newNode: newNode}}).
+			Build()
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, mutating, validating)
+	}
+	return webhooks, nil
+}
+
+// Add creates the admission webhook server and adds it to the Manager
+func Add(mgr manager.Manager, config Config) error {
+	srv, err := webhook.NewServer("wg-operator-admission-server", mgr, webhook.ServerOptions{
+		Port:    config.Port,
+		CertDir: config.CertDir,
+		BootstrapOptions: &webhook.BootstrapOptions{
+			Secret: &types.NamespacedName{Namespace: config.Namespace, Name: config.ServiceName + "-cert"},
+			Service: &webhook.Service{
+				Namespace: config.Namespace,
+				Name:      config.ServiceName,
+				// matches the controller pods in deploy/controller.yaml
+				Selectors: map[string]string{"app": "wg-operator-controller"},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	servers, err := build(mgr, "server", func() wgv1alpha1.VPNNode { return &wgv1alpha1.Server{} })
+	if err != nil {
+		return err
+	}
+	clients, err := build(mgr, "client", func() wgv1alpha1.VPNNode { return &wgv1alpha1.Client{} })
+	if err != nil {
+		return err
+	}
+	policies, err := builder.NewWebhookBuilder().
+		Name("validate-peerpolicy.wg.krakensystems.co").
+		Path("/validate-peerpolicy").
+		Validating().
+		Operations(admissionregistrationv1beta1.Create, admissionregistrationv1beta1.Update).
+		FailurePolicy(admissionregistrationv1beta1.Fail).
+		WithManager(mgr).
+		ForType(&wgv1alpha1.PeerPolicy{}).
+		Handlers(&policyValidator{}).
+		Build()
+	if err != nil {
+		return err
+	}
+	return srv.Register(append(append(servers, clients...), policies)...)
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/KrakenSystems/wg-operator/pkg/apis"
+	wgv1alpha1 "github.com/KrakenSystems/wg-operator/pkg/apis/wg/v1alpha1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	atypes "sigs.k8s.io/controller-runtime/pkg/webhook/admission/types"
+)
+
+func raw(t *testing.T, obj runtime.Object) runtime.RawExtension {
+	b, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime.RawExtension{Raw: b}
+}
+
+// TestValidator_delete checks an invalid client, e.g. one created before the webhook, can drop its finalizer
+// and be deleted, while other changes to it are still rejected
+func TestValidator_delete(t *testing.T) {
+	if err := apis.AddToScheme(scheme.Scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme.Scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &validator{nodeHandler{newNode: func() wgv1alpha1.VPNNode { return &wgv1alpha1.Client{} }}}
+	if err := h.InjectDecoder(decoder); err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := &wgv1alpha1.Client{
+		TypeMeta: metav1.TypeMeta{APIVersion: wgv1alpha1.SchemeGroupVersion.String(), Kind: "Client"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "laptop",
+			Namespace:   "wg",
+			Annotations: map[string]string{"priv-key": "secret"},
+			Finalizers:  []string{wgv1alpha1.InterfaceFinalizer},
+		},
+	}
+	deleting := invalid.DeepCopy()
+	now := metav1.NewTime(time.Date(2019, 3, 1, 10, 0, 0, 0, time.UTC))
+	deleting.DeletionTimestamp = &now
+	finalized := deleting.DeepCopy()
+	finalized.Finalizers = nil
+	relabeled := invalid.DeepCopy()
+	relabeled.Labels = map[string]string{"team": "ops"}
+	changed := invalid.DeepCopy()
+	changed.Spec.Endpoint = "vpn.example.com:51820"
+
+	tests := []struct {
+		name     string
+		op       admissionv1beta1.Operation
+		old, obj *wgv1alpha1.Client
+		allowed  bool
+	}{
+		{"create", admissionv1beta1.Create, nil, invalid, false},
+		{"spec changed", admissionv1beta1.Update, invalid, changed, false},
+		{"labels changed", admissionv1beta1.Update, invalid, relabeled, true},
+		{"finalizer removed", admissionv1beta1.Update, deleting, finalized, true},
+		{"deleting", admissionv1beta1.Update, deleting, deleting, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &admissionv1beta1.AdmissionRequest{Operation: tt.op, Object: raw(t, tt.obj)}
+			if tt.old != nil {
+				req.OldObject = raw(t, tt.old)
+			}
+			resp := h.Handle(context.Background(), atypes.Request{AdmissionRequest: req})
+			if resp.Response.Allowed != tt.allowed {
+				t.Errorf("allowed = %v (%v), want %v", resp.Response.Allowed, resp.Response.Result, tt.allowed)
+			}
+		})
+	}
+}